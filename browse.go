@@ -0,0 +1,198 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+#include <stdlib.h>
+
+extern void browseCallback(DNSServiceRef, DNSServiceFlags, uint32_t, DNSServiceErrorType, const char *, const char *, const char *, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// BrowseCallback reports a service instance coming or going. add is
+// true when the instance has appeared and false when it has gone away.
+type BrowseCallback func(op *BrowseOp, err error, add bool, interfaceIndex int, name string, serviceType string, domain string)
+
+// BrowseOp discovers service instances of a given type via
+// DNSServiceBrowse.
+type BrowseOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex int
+	regtype string
+	subtype string
+	domain  string
+
+	cb BrowseCallback
+}
+
+// NewBrowseOp creates a BrowseOp that will discover instances of
+// regtype once Started.
+func NewBrowseOp(regtype string, cb BrowseCallback) *BrowseOp {
+	return &BrowseOp{
+		regtype: regtype,
+		cb:      cb,
+	}
+}
+
+// NewBrowseOpSubtype creates a BrowseOp that will discover only
+// instances of regtype advertising the given DNS-SD subtype (RFC 6763
+// §7.1), e.g. regtype "_http._tcp", subtype "printer" browses
+// "printer._sub._http._tcp".
+func NewBrowseOpSubtype(regtype, subtype string, cb BrowseCallback) *BrowseOp {
+	return &BrowseOp{
+		regtype: regtype,
+		subtype: subtype,
+		cb:      cb,
+	}
+}
+
+// SetSubtype restricts browsing to instances advertising the given
+// DNS-SD subtype, as NewBrowseOpSubtype. Pass "" to browse the bare
+// regtype again. It must be called before Start.
+func (op *BrowseOp) SetSubtype(subtype string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	if subtype != "" {
+		if err := validateSubtype(subtype); err != nil {
+			return err
+		}
+	}
+	op.subtype = subtype
+	return nil
+}
+
+// fullRegtype returns the service type DNSServiceBrowse should be
+// called with, qualified with the subtype selector if one was set.
+func (op *BrowseOp) fullRegtype() string {
+	if op.subtype == "" {
+		return op.regtype
+	}
+	return op.subtype + "._sub." + op.regtype
+}
+
+// SetInterfaceIndex restricts browsing to a single interface. It must be
+// called before Start.
+func (op *BrowseOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetDomain overrides the domain to browse in. It must be called
+// before Start.
+func (op *BrowseOp) SetDomain(domain string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.domain = domain
+	return nil
+}
+
+// Start begins browsing, returning ErrStarted if it is already active.
+func (op *BrowseOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	cRegtype := C.CString(op.fullRegtype())
+	defer C.free(unsafe.Pointer(cRegtype))
+	var cDomain *C.char
+	if op.domain != "" {
+		cDomain = C.CString(op.domain)
+		defer C.free(unsafe.Pointer(cDomain))
+	}
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceBrowse(&op.sdRef, 0, C.uint32_t(op.ifIndex), cRegtype, cDomain,
+		C.DNSServiceBrowseReply(C.browseCallback), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	op.done = make(chan struct{})
+	op.mu.Lock()
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(op.sdRef, op.done)
+		op.mu.Lock()
+		op.active = false
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels browsing and releases the op's underlying resources. It
+// is a no-op if the op is not active.
+func (op *BrowseOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently browsing.
+func (op *BrowseOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins browsing, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *BrowseOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts browsing and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *BrowseOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *BrowseOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export browseCallback
+func browseCallback(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, ifIndex C.uint32_t, errorCode C.DNSServiceErrorType, name, regtype, domain *C.char, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*BrowseOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	add := flags&C.kDNSServiceFlagsAdd != 0
+	op.cb(op, err, add, int(ifIndex), C.GoString(name), C.GoString(regtype), C.GoString(domain))
+}
@@ -0,0 +1,317 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// browseQueryInterval is the fixed re-query period used instead of RFC
+// 6762 §5.2's exponentially increasing (capped at 60 minutes) schedule,
+// which matters for long-lived low-traffic browses more than it does
+// for the short-lived ones this package is typically used for.
+const browseQueryInterval = 10 * time.Second
+
+// BrowseCallback reports a service instance coming or going. add is
+// true when the instance has appeared and false when a goodbye packet
+// (its PTR record with TTL 0) has withdrawn it. An instance whose PTR
+// record's TTL lapses without a goodbye is not reported as removed.
+type BrowseCallback func(op *BrowseOp, err error, add bool, interfaceIndex int, name string, serviceType string, domain string)
+
+// BrowseOp discovers service instances of a given type by sending PTR
+// queries and listening for answers, the pure-Go equivalent of
+// DNSServiceBrowse.
+type BrowseOp struct {
+	mu     sync.Mutex
+	active bool
+	errCh  chan error
+	done   chan struct{}
+	conn   mdnsConn
+
+	ifIndex int
+	regtype string
+	subtype string
+	domain  string
+
+	// known caches each discovered instance's expiry: it dedupes local
+	// delivery so a repeated query's answer doesn't re-deliver an "add"
+	// for an instance already known (and lets a goodbye for a known
+	// instance be delivered as a "remove"; entries whose expiry has passed
+	// stay in the map until a goodbye arrives), and queryLoop also
+	// serializes the unexpired ones into
+	// each outgoing query's answers section as RFC 6762 §5.2 known-answer
+	// suppression proper.
+	known map[string]time.Time
+
+	cb BrowseCallback
+}
+
+// NewBrowseOp creates a BrowseOp that will discover instances of
+// regtype once Started.
+func NewBrowseOp(regtype string, cb BrowseCallback) *BrowseOp {
+	return &BrowseOp{regtype: regtype, cb: cb, known: make(map[string]time.Time)}
+}
+
+// NewBrowseOpSubtype creates a BrowseOp that will discover only
+// instances of regtype advertising the given DNS-SD subtype (RFC 6763
+// §7.1).
+func NewBrowseOpSubtype(regtype, subtype string, cb BrowseCallback) *BrowseOp {
+	return &BrowseOp{regtype: regtype, subtype: subtype, cb: cb, known: make(map[string]time.Time)}
+}
+
+// SetSubtype restricts browsing to instances advertising the given
+// DNS-SD subtype, as NewBrowseOpSubtype. Pass "" to browse the bare
+// regtype again. It must be called before Start.
+func (op *BrowseOp) SetSubtype(subtype string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	if subtype != "" {
+		if err := validateSubtype(subtype); err != nil {
+			return err
+		}
+	}
+	op.subtype = subtype
+	return nil
+}
+
+// SetInterfaceIndex restricts browsing to a single interface. It must be
+// called before Start.
+func (op *BrowseOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetDomain overrides the domain to browse in, "local" by default. It
+// must be called before Start.
+func (op *BrowseOp) SetDomain(domain string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.domain = domain
+	return nil
+}
+
+func (op *BrowseOp) domainOrDefault() string {
+	if op.domain == "" {
+		return "local"
+	}
+	return op.domain
+}
+
+// fullRegtype returns the service type qualified with the subtype
+// selector if one was set, in the same form as the dns_sd.h backend.
+func (op *BrowseOp) fullRegtype() string {
+	if op.subtype == "" {
+		return op.regtype
+	}
+	return op.subtype + "._sub." + op.regtype
+}
+
+func (op *BrowseOp) queryName() string {
+	base := op.regtype + "." + op.domainOrDefault() + "."
+	if op.subtype == "" {
+		return base
+	}
+	return op.subtype + "._sub." + base
+}
+
+// Start begins browsing, returning ErrStarted if it is already active.
+func (op *BrowseOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	op.conn = conn
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	go op.queryLoop(conn)
+	go op.listenLoop(conn)
+	return nil
+}
+
+// queryLoop and listenLoop take conn as a parameter, rather than
+// reading op.conn, so that a Start immediately following a Stop can't
+// race the previous Stop's goroutines over the op.conn field.
+func (op *BrowseOp) queryLoop(conn mdnsConn) {
+	queryName := op.queryName()
+	q := question{name: queryName, qtype: rrTypePTR}
+	for {
+		conn.Send(&message{questions: []question{q}, answers: op.knownAnswers(queryName)}, nil)
+		select {
+		case <-op.done:
+			return
+		case <-time.After(browseQueryInterval):
+		}
+	}
+}
+
+// knownAnswers returns the still-unexpired PTR records this browse has
+// already learned about, for inclusion in the next outgoing query as
+// RFC 6762 §5.2 known-answer suppression: a responder that sees its own
+// record already listed, with at least half its original TTL
+// remaining, skips answering it again.
+func (op *BrowseOp) knownAnswers(queryName string) []resourceRecord {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if len(op.known) == 0 {
+		return nil
+	}
+	now := time.Now()
+	known := make([]resourceRecord, 0, len(op.known))
+	for instance, expiry := range op.known {
+		remaining := expiry.Sub(now)
+		if remaining <= 0 {
+			continue
+		}
+		known = append(known, resourceRecord{
+			name:   queryName,
+			rrtype: rrTypePTR,
+			ttl:    uint32(remaining / time.Second),
+			rdata:  encodeDomainName(instance),
+		})
+	}
+	return known
+}
+
+func (op *BrowseOp) listenLoop(conn mdnsConn) {
+	queryName := op.queryName()
+	for {
+		msg, _, err := conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		for _, rr := range append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...) {
+			if rr.rrtype != rrTypePTR || rr.name != queryName {
+				continue
+			}
+			instance, _, err := decodeDomainName(rr.rdata, 0)
+			if err != nil {
+				continue
+			}
+			name, serviceType, domain := splitInstanceName(instance)
+
+			op.mu.Lock()
+			_, known := op.known[instance]
+			if rr.ttl == 0 {
+				delete(op.known, instance)
+			} else {
+				op.known[instance] = time.Now().Add(time.Duration(rr.ttl) * time.Second)
+			}
+			op.mu.Unlock()
+
+			if rr.ttl == 0 {
+				if known {
+					op.cb(op, nil, false, op.ifIndex, name, serviceType, domain)
+				}
+				continue
+			}
+			if !known {
+				op.cb(op, nil, true, op.ifIndex, name, serviceType, domain)
+			}
+		}
+	}
+}
+
+// splitInstanceName splits a fully qualified "name.service.domain."
+// into its three dotted components, assuming the service type is
+// always the two labels immediately preceding the domain's first
+// label, e.g. "My Printer._http._tcp.local." -> ("My Printer",
+// "_http._tcp", "local").
+func splitInstanceName(fullname string) (name, serviceType, domain string) {
+	fullname = strings.TrimSuffix(fullname, ".")
+	labels := strings.Split(fullname, ".")
+	if len(labels) < 4 {
+		return fullname, "", ""
+	}
+	n := len(labels)
+	domain = labels[n-1]
+	serviceType = labels[n-3] + "." + labels[n-2]
+	name = strings.Join(labels[:n-3], ".")
+	return name, serviceType, domain
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when listenLoop's Recv fails on its own rather than
+// because Stop already closed conn itself. It is a no-op if Stop has
+// already deactivated the op.
+func (op *BrowseOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, false, op.ifIndex, "", "", "")
+}
+
+// Stop cancels browsing and releases the op's underlying resources. It
+// is a no-op if the op is not active.
+func (op *BrowseOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	op.mu.Unlock()
+	close(done)
+	conn.Close()
+}
+
+// Active reports whether the op is currently browsing.
+func (op *BrowseOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins browsing, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *BrowseOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts browsing and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *BrowseOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *BrowseOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
@@ -0,0 +1,93 @@
+// Package dnssd provides Go bindings to DNS Service Discovery (DNS-SD
+// and its mDNS transport, Bonjour). Service registration, browsing,
+// resolution, address lookup and raw record queries are each modelled
+// as an "Op": a value that is constructed with a callback, started,
+// runs in the background delivering results to that callback, and is
+// stopped when no longer needed.
+//
+// By default the package is a thin wrapper over Apple's dns_sd.h
+// daemon (cgo, requires mDNSResponder/Bonjour). Building with the
+// "dnssd_pure" tag swaps in a pure-Go mDNS implementation that speaks
+// RFC 6762 directly over UDP 5353, for platforms without the daemon.
+// Both expose the same Op types and build tag selects which one
+// compiles; see SetBackend for a runtime hook within the pure-Go build.
+package dnssd
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors returned by the various Start, Set* and TXT record helpers.
+var (
+	// ErrStarted is returned by Start if the op is already active, and
+	// by Set* methods that may not be called once an op is running.
+	ErrStarted = errors.New("dnssd: op already started")
+	// ErrNotStarted is returned by methods that require the op to be
+	// active, such as adding a record to a running registration.
+	ErrNotStarted = errors.New("dnssd: op not started")
+	// ErrTXTStringLen is returned by SetTXTPair and friends when a
+	// single key/value pair would exceed the 255 byte limit imposed by
+	// the one-byte TXT record string length prefix (RFC 6763 §6.1).
+	ErrTXTStringLen = errors.New("dnssd: TXT key/value pair too long")
+	// ErrTXTLen is returned when adding a pair would grow the encoded
+	// TXT record past the 65535 byte limit enforced by dns_sd.h.
+	ErrTXTLen = errors.New("dnssd: TXT record too long")
+	// ErrInvalidSubtype is returned by SetSubtypes, SetSubtype and
+	// AddSubtypeRecord when a subtype label is empty, longer than 63
+	// bytes, or contains a '.' (RFC 6763 §7.1).
+	ErrInvalidSubtype = errors.New("dnssd: invalid subtype label")
+)
+
+// Interface index selectors recognised by dns_sd.h. Any other value is
+// treated as a real interface index, e.g. from net.Interface.Index.
+const (
+	// InterfaceIndexAny lets mDNSResponder use all applicable interfaces.
+	InterfaceIndexAny = 0
+	// InterfaceIndexLocalOnly restricts the operation to the local host.
+	InterfaceIndexLocalOnly = -1
+	// InterfaceIndexUnicast forces the operation over unicast DNS.
+	InterfaceIndexUnicast = -2
+	// InterfaceIndexP2P restricts the operation to peer-to-peer interfaces.
+	InterfaceIndexP2P = -3
+)
+
+// contextOp is satisfied by every Op type, letting StartContext and Run
+// be implemented once instead of once per op.
+type contextOp interface {
+	Start() error
+	Stop()
+	errChan() chan error
+}
+
+// startContext implements StartContext for any contextOp: it starts op
+// and arranges for Stop to be called automatically when ctx is
+// cancelled or its deadline expires.
+func startContext(ctx context.Context, op contextOp) error {
+	op.errChan() // allocate before Start so the callback can never race past it
+	if err := op.Start(); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		op.Stop()
+	}()
+	return nil
+}
+
+// runContext implements Run for any contextOp: it starts op and blocks
+// until ctx is done or an error is delivered on the callback, stopping
+// op before returning.
+func runContext(ctx context.Context, op contextOp) error {
+	errCh := op.errChan()
+	if err := op.Start(); err != nil {
+		return err
+	}
+	defer op.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		return err
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#cgo darwin LDFLAGS: -framework CoreFoundation
+#cgo !darwin pkg-config: dns_sd
+#include <dns_sd.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import "fmt"
+
+// newError converts a dns_sd.h DNSServiceErrorType into a Go error, or
+// nil if ec reports success.
+func newError(ec C.DNSServiceErrorType) error {
+	if ec == C.kDNSServiceErr_NoError {
+		return nil
+	}
+	return fmt.Errorf("dnssd: error %d", int(ec))
+}
+
+// run blocks processing results for sdRef, invoking the op's C callback
+// for each one, until either DNSServiceProcessResult reports an error
+// (typically because Stop deallocated sdRef from under it) or done is
+// closed.
+func run(sdRef C.DNSServiceRef, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if ec := C.DNSServiceProcessResult(sdRef); ec != C.kDNSServiceErr_NoError {
+			return
+		}
+	}
+}
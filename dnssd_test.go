@@ -2,7 +2,9 @@ package dnssd
 
 import (
 	"fmt"
+	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -75,6 +77,38 @@ func TestRegTxt(t *testing.T) {
 	}
 }
 
+func TestTXTKeyCaseInsensitive(t *testing.T) {
+	op := &RegisterOp{}
+	if err := op.SetTXTPair("Foo", "1"); err != nil {
+		t.Fatalf(`Unexpected error setting key "Foo": %v`, err)
+	}
+	if err := op.SetTXTPair("foo", "2"); err != nil {
+		t.Fatalf(`Unexpected error setting key "foo": %v`, err)
+	}
+	if l := 2 + len("foo") + len("2"); op.txt.l != l {
+		t.Fatalf(`Expected "Foo" to be replaced by "foo", got combined length %d`, op.txt.l)
+	}
+	if err := op.DeleteTXTPair("FOO"); err != nil {
+		t.Fatalf(`Unexpected error deleting "FOO" after setting "foo": %v`, err)
+	}
+	if op.txt.l != 0 {
+		t.Fatalf(`Expected length 0 after deleting "FOO", got: %v`, op.txt.l)
+	}
+}
+
+func TestSubtypeFullRegtypeMatch(t *testing.T) {
+	regOp := &RegisterOp{regtype: "_http._tcp"}
+	if err := regOp.SetSubtypes([]string{"printer"}); err != nil {
+		t.Fatalf("Unexpected error setting subtype: %v", err)
+	}
+	browseOp := NewBrowseOpSubtype("_http._tcp", "printer", nil)
+	regSubtype := strings.SplitN(regOp.fullRegtype(), ",", 2)[1]
+	browseSubtype := strings.TrimSuffix(browseOp.fullRegtype(), "._sub._http._tcp")
+	if regSubtype != browseSubtype {
+		t.Fatalf("RegisterOp and BrowseOp compose different subtype owner names: %q vs %q", regSubtype, browseSubtype)
+	}
+}
+
 func TestBrowseStartStop(t *testing.T) {
 	f := func(op *BrowseOp, e error, add bool, interfaceIndex int, name string, serviceType string, domain string) {
 	}
@@ -82,14 +116,14 @@ func TestBrowseStartStop(t *testing.T) {
 }
 
 func TestResolveStartStop(t *testing.T) {
-	f := func(op *ResolveOp, e error, host string, port int, txt map[string]string) {
+	f := func(op *ResolveOp, e error, host string, port int, txt map[string]string, record TXTRecord) {
 	}
 	StartStopHelper(t, NewResolveOp(0, "go", "_go-dnssd._tcp", "local", f))
 }
 
 func TestDecodeTxtBadLength(t *testing.T) {
 	b := []byte{255, 'b', '=', 'b'}
-	m := decodeTxt(b)
+	m := decodeTxt(b).Map()
 	if v, p := m["b"]; p != false {
 		t.Fatalf(`Expected pair "b" to be missing, instead it's present with value %v`, v)
 	}
@@ -97,7 +131,7 @@ func TestDecodeTxtBadLength(t *testing.T) {
 
 func TestDecodeTxtKeyNoValue(t *testing.T) {
 	b := []byte{1, 'a', 2, 'b', '=', 1, '=', 2, '=', 'a'}
-	m := decodeTxt(b)
+	m := decodeTxt(b).Map()
 	keys := []string{"a", "b", "=", "=a"}
 	for _, k := range keys {
 		if v, p := m[k]; v != "" {
@@ -108,7 +142,7 @@ func TestDecodeTxtKeyNoValue(t *testing.T) {
 
 func TestDecodeTxtKeyValue(t *testing.T) {
 	b := []byte{3, 'a', '=', 'a', 3, 'b', '=', 'b', 5, 'a', 'b', '=', 'a', 'b'}
-	m := decodeTxt(b)
+	m := decodeTxt(b).Map()
 	for _, kv := range []string{"a", "b", "ab"} {
 		if v, p := m[kv]; v != kv {
 			t.Fatalf(`Expected "%s" to return "%s", got %v instead (present: %v)`, kv, kv, v, p)
@@ -116,25 +150,48 @@ func TestDecodeTxtKeyValue(t *testing.T) {
 	}
 }
 
+func TestDecodeTxtMapPreservesKeyCase(t *testing.T) {
+	b := []byte{9, 'M', 'o', 'd', 'e', 'l', '=', 'f', 'o', 'o'}
+	m := decodeTxt(b).Map()
+	if v, p := m["Model"]; !p || v != "foo" {
+		t.Fatalf(`Expected "Model" to be present with value "foo", got %v (present: %v)`, v, p)
+	}
+	if _, p := m["model"]; p {
+		t.Fatalf(`Expected "model" to be absent from Map(), which should preserve the published key casing`)
+	}
+}
+
 func TestQueryStartStop(t *testing.T) {
 	f := func(op *QueryOp, err error, add, more bool, interfaceIndex int, fullname string, rrtype, rrclass uint16, rdata []byte, ttl uint32) {
 	}
 	StartStopHelper(t, NewQueryOp(0, "golang.org.", 1, 1, f))
 }
 
+func TestGetAddrInfoStartStop(t *testing.T) {
+	f := func(op *GetAddrInfoOp, err error, add, more bool, ifIndex int, hostname string, addr net.IP, ttl uint32) {
+	}
+	StartStopHelper(t, NewGetAddrInfoOp("golang.org.", f))
+}
+
 func TestRegisterPort(t *testing.T) {
 	sport := 0xCAFE
 	sname := "go-dnssd-test"
 	stype := "_" + sname + "._udp"
 	sdom := "local"
-	errch := make(chan string)
+	// errch carries the outcome exactly once: either the first failure or
+	// a successful resolve closes it. once guards against a callback
+	// firing again afterwards -- e.g. register's "rmv" callback
+	// restarting resop -- sending on or closing an already-decided
+	// channel.
+	errch := make(chan string, 1)
+	var once sync.Once
 	senderr := func(f string, a ...interface{}) {
-		select {
-		case errch <- fmt.Sprintf(f, a...):
-		default:
-		}
+		once.Do(func() { errch <- fmt.Sprintf(f, a...) })
+	}
+	succeed := func() {
+		once.Do(func() { close(errch) })
 	}
-	resop := NewResolveOp(InterfaceIndexLocalOnly, sname, stype, sdom, func(op *ResolveOp, err error, host string, port int, txt map[string]string) {
+	resop := NewResolveOp(InterfaceIndexLocalOnly, sname, stype, sdom, func(op *ResolveOp, err error, host string, port int, txt map[string]string, record TXTRecord) {
 		switch {
 		case err != nil:
 			senderr("resolve callback - error: %s", err)
@@ -142,7 +199,7 @@ func TestRegisterPort(t *testing.T) {
 			senderr("resolve callback - bad port. expected: %d got: %d", sport, port)
 		default:
 			t.Logf("resolve callback - called with correct port")
-			close(errch)
+			succeed()
 		}
 	})
 	regop := NewRegisterOp(sname, stype, sport, func(op *RegisterOp, err error, add bool, name, serviceType, domain string) {
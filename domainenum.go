@@ -0,0 +1,162 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+
+extern void domainEnumReply(DNSServiceRef, DNSServiceFlags, uint32_t, DNSServiceErrorType, const char *, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// DomainEnumerationCallback reports a domain found (or withdrawn) by a
+// DomainEnumerationOp. add is true when the domain has appeared and
+// false when it has gone away; more is true if additional domains from
+// the same underlying packet are still to be delivered.
+type DomainEnumerationCallback func(op *DomainEnumerationOp, err error, add, more bool, ifIndex int, domain string)
+
+// DomainEnumerationOp discovers the domains recommended for browsing or
+// registration via DNSServiceEnumerateDomains, so that callers need not
+// hard-code "local".
+type DomainEnumerationOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex int
+	flags   DomainEnumFlags
+
+	cb DomainEnumerationCallback
+}
+
+// NewDomainEnumerationOp creates a DomainEnumerationOp that will
+// enumerate browse domains once Started. Call SetFlags before Start to
+// enumerate registration domains instead.
+func NewDomainEnumerationOp(cb DomainEnumerationCallback) *DomainEnumerationOp {
+	return &DomainEnumerationOp{cb: cb}
+}
+
+// SetInterfaceIndex restricts enumeration to a single interface. It
+// must be called before Start.
+func (op *DomainEnumerationOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetFlags selects whether browse domains (the default) or registration
+// domains are enumerated. It must be called before Start.
+func (op *DomainEnumerationOp) SetFlags(flags DomainEnumFlags) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.flags = flags
+	return nil
+}
+
+// Start begins enumeration, returning ErrStarted if it is already
+// active.
+func (op *DomainEnumerationOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	var flags C.DNSServiceFlags
+	switch op.flags {
+	case RegistrationDomains:
+		flags = C.kDNSServiceFlagsRegistrationDomains
+	default:
+		flags = C.kDNSServiceFlagsBrowseDomains
+	}
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceEnumerateDomains(&op.sdRef, flags, C.uint32_t(op.ifIndex),
+		C.DNSServiceDomainEnumReply(C.domainEnumReply), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	op.done = make(chan struct{})
+	op.mu.Lock()
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(op.sdRef, op.done)
+		op.mu.Lock()
+		op.active = false
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels enumeration and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *DomainEnumerationOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently enumerating.
+func (op *DomainEnumerationOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins enumeration, as Start, and arranges for Stop to
+// be called automatically when ctx is cancelled or its deadline
+// expires.
+func (op *DomainEnumerationOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts enumeration and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *DomainEnumerationOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *DomainEnumerationOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export domainEnumReply
+func domainEnumReply(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, ifIndex C.uint32_t, errorCode C.DNSServiceErrorType, replyDomain *C.char, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*DomainEnumerationOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	add := flags&C.kDNSServiceFlagsAdd != 0
+	more := flags&C.kDNSServiceFlagsMoreComing != 0
+	op.cb(op, err, add, more, int(ifIndex), C.GoString(replyDomain))
+}
@@ -0,0 +1,61 @@
+package dnssd
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DomainEnumFlags selects which class of domain a DomainEnumerationOp
+// enumerates.
+type DomainEnumFlags int
+
+const (
+	// BrowseDomains enumerates domains recommended for browsing
+	// (b._dns-sd._udp.<domain>).
+	BrowseDomains DomainEnumFlags = iota
+	// RegistrationDomains enumerates domains recommended for
+	// registration (r._dns-sd._udp.<domain>).
+	RegistrationDomains
+)
+
+// domainEnumerationTimeout bounds how long DefaultBrowseDomains and
+// DefaultRegistrationDomains wait for replies before returning whatever
+// domains have been discovered so far.
+const domainEnumerationTimeout = 2 * time.Second
+
+func collectDefaultDomains(flags DomainEnumFlags) ([]string, error) {
+	var domains []string
+	seen := make(map[string]bool)
+	op := NewDomainEnumerationOp(func(op *DomainEnumerationOp, err error, add, more bool, ifIndex int, domain string) {
+		if err != nil || !add || seen[domain] {
+			return
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	})
+	if err := op.SetFlags(flags); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), domainEnumerationTimeout)
+	defer cancel()
+	if err := op.Run(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// DefaultBrowseDomains returns the domains recommended for browsing,
+// waiting briefly for replies before returning whatever has been
+// discovered so far.
+func DefaultBrowseDomains() ([]string, error) {
+	return collectDefaultDomains(BrowseDomains)
+}
+
+// DefaultRegistrationDomains returns the domains recommended for
+// registration, waiting briefly for replies before returning whatever
+// has been discovered so far.
+func DefaultRegistrationDomains() ([]string, error) {
+	return collectDefaultDomains(RegistrationDomains)
+}
@@ -0,0 +1,204 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DomainEnumerationCallback reports a domain found (or withdrawn) by a
+// DomainEnumerationOp. add is true when the domain has appeared and
+// false when a goodbye packet (its PTR record with TTL 0) has withdrawn
+// it. A domain whose PTR record's TTL lapses without a goodbye is not
+// reported as removed.
+type DomainEnumerationCallback func(op *DomainEnumerationOp, err error, add, more bool, ifIndex int, domain string)
+
+// DomainEnumerationOp discovers the domains recommended for browsing or
+// registration by querying the b._dns-sd._udp.<domain> or
+// r._dns-sd._udp.<domain> meta-query PTR records defined by RFC 6763
+// §11, the pure-Go equivalent of DNSServiceEnumerateDomains.
+type DomainEnumerationOp struct {
+	mu     sync.Mutex
+	active bool
+	errCh  chan error
+	done   chan struct{}
+	conn   mdnsConn
+
+	ifIndex int
+	flags   DomainEnumFlags
+	known   map[string]time.Time
+
+	cb DomainEnumerationCallback
+}
+
+// NewDomainEnumerationOp creates a DomainEnumerationOp that will
+// enumerate browse domains once Started. Call SetFlags before Start to
+// enumerate registration domains instead.
+func NewDomainEnumerationOp(cb DomainEnumerationCallback) *DomainEnumerationOp {
+	return &DomainEnumerationOp{cb: cb, known: make(map[string]time.Time)}
+}
+
+// SetInterfaceIndex restricts enumeration to a single interface. It
+// must be called before Start.
+func (op *DomainEnumerationOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetFlags selects whether browse domains (the default) or registration
+// domains are enumerated. It must be called before Start.
+func (op *DomainEnumerationOp) SetFlags(flags DomainEnumFlags) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.flags = flags
+	return nil
+}
+
+func (op *DomainEnumerationOp) queryName() string {
+	base := "b._dns-sd._udp.local."
+	if op.flags == RegistrationDomains {
+		base = "r._dns-sd._udp.local."
+	}
+	return base
+}
+
+// Start begins enumeration, returning ErrStarted if it is already
+// active.
+func (op *DomainEnumerationOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	op.conn = conn
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	op.conn.Send(&message{questions: []question{{name: op.queryName(), qtype: rrTypePTR}}}, nil)
+	go op.listenLoop()
+	return nil
+}
+
+func (op *DomainEnumerationOp) listenLoop() {
+	queryName := op.queryName()
+	for {
+		msg, _, err := op.conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		answers := append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...)
+		for i, rr := range answers {
+			if rr.rrtype != rrTypePTR || rr.name != queryName {
+				continue
+			}
+			domain, _, err := decodeDomainName(rr.rdata, 0)
+			if err != nil {
+				continue
+			}
+			more := i < len(answers)-1
+
+			op.mu.Lock()
+			_, known := op.known[domain]
+			if rr.ttl == 0 {
+				delete(op.known, domain)
+			} else {
+				op.known[domain] = time.Now().Add(time.Duration(rr.ttl) * time.Second)
+			}
+			op.mu.Unlock()
+
+			if rr.ttl == 0 {
+				if known {
+					op.cb(op, nil, false, more, op.ifIndex, domain)
+				}
+				continue
+			}
+			if !known {
+				op.cb(op, nil, true, more, op.ifIndex, domain)
+			}
+		}
+	}
+}
+
+// Stop cancels enumeration and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *DomainEnumerationOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	op.mu.Unlock()
+	close(done)
+	conn.Close()
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when listenLoop's Recv fails on its own rather than
+// because Stop already closed conn itself. It is a no-op if Stop has
+// already deactivated the op.
+func (op *DomainEnumerationOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, false, false, op.ifIndex, "")
+}
+
+// Active reports whether the op is currently enumerating.
+func (op *DomainEnumerationOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins enumeration, as Start, and arranges for Stop to
+// be called automatically when ctx is cancelled or its deadline
+// expires.
+func (op *DomainEnumerationOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts enumeration and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *DomainEnumerationOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *DomainEnumerationOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
@@ -0,0 +1,202 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+#include <stdlib.h>
+
+extern void getAddrInfoCallback(DNSServiceRef, DNSServiceFlags, uint32_t, DNSServiceErrorType, const char *, const struct sockaddr *, uint32_t, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"net"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// Protocol selects which address families a GetAddrInfoOp resolves.
+type Protocol int
+
+const (
+	// ProtocolBoth resolves both IPv4 (A) and IPv6 (AAAA) addresses.
+	ProtocolBoth Protocol = iota
+	// ProtocolIPv4 restricts resolution to IPv4 (A) addresses.
+	ProtocolIPv4
+	// ProtocolIPv6 restricts resolution to IPv6 (AAAA) addresses.
+	ProtocolIPv6
+)
+
+// GetAddrInfoCallback reports an address for hostname. add is true when
+// the address has appeared and false when it has gone away; more is
+// true if additional addresses from the same underlying packet are
+// still to be delivered.
+type GetAddrInfoCallback func(op *GetAddrInfoOp, err error, add, more bool, ifIndex int, hostname string, addr net.IP, ttl uint32)
+
+// GetAddrInfoOp resolves a hostname, typically one previously returned
+// by a ResolveOp, to its IP addresses via DNSServiceGetAddrInfo. It
+// completes the browse -> resolve -> connect flow without requiring
+// callers to drop out to the standard library resolver.
+type GetAddrInfoOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex  int
+	hostname string
+	protocol Protocol
+
+	cb GetAddrInfoCallback
+}
+
+// NewGetAddrInfoOp creates a GetAddrInfoOp that will resolve hostname
+// once Started.
+func NewGetAddrInfoOp(hostname string, cb GetAddrInfoCallback) *GetAddrInfoOp {
+	return &GetAddrInfoOp{
+		hostname: hostname,
+		cb:       cb,
+	}
+}
+
+// SetInterfaceIndex restricts resolution to a single interface. It must
+// be called before Start.
+func (op *GetAddrInfoOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetProtocol restricts resolution to IPv4-only, IPv6-only, or both (the
+// default). It must be called before Start.
+func (op *GetAddrInfoOp) SetProtocol(protocol Protocol) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.protocol = protocol
+	return nil
+}
+
+// Start begins resolution, returning ErrStarted if it is already active.
+func (op *GetAddrInfoOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	var protocols C.DNSServiceProtocol
+	switch op.protocol {
+	case ProtocolIPv4:
+		protocols = C.kDNSServiceProtocol_IPv4
+	case ProtocolIPv6:
+		protocols = C.kDNSServiceProtocol_IPv6
+	default:
+		protocols = C.kDNSServiceProtocol_IPv4 | C.kDNSServiceProtocol_IPv6
+	}
+
+	cHostname := C.CString(op.hostname)
+	defer C.free(unsafe.Pointer(cHostname))
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceGetAddrInfo(&op.sdRef, 0, C.uint32_t(op.ifIndex), protocols, cHostname,
+		C.DNSServiceGetAddrInfoReply(C.getAddrInfoCallback), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	op.done = make(chan struct{})
+	op.mu.Lock()
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(op.sdRef, op.done)
+		op.mu.Lock()
+		op.active = false
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels resolution and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *GetAddrInfoOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently resolving.
+func (op *GetAddrInfoOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins resolution, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *GetAddrInfoOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts resolution and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *GetAddrInfoOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *GetAddrInfoOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export getAddrInfoCallback
+func getAddrInfoCallback(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, ifIndex C.uint32_t, errorCode C.DNSServiceErrorType, hostname *C.char, address *C.struct_sockaddr, ttl C.uint32_t, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*GetAddrInfoOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	add := flags&C.kDNSServiceFlagsAdd != 0
+	more := flags&C.kDNSServiceFlagsMoreComing != 0
+	op.cb(op, err, add, more, int(ifIndex), C.GoString(hostname), sockaddrToIP(address), uint32(ttl))
+}
+
+// sockaddrToIP converts a C sockaddr_in or sockaddr_in6, as delivered by
+// DNSServiceGetAddrInfo, into a net.IP. dns_sd.h only guarantees sa is
+// valid for the duration of the callback, so the address bytes are
+// copied into Go-owned memory rather than aliased.
+func sockaddrToIP(sa *C.struct_sockaddr) net.IP {
+	switch sa.sa_family {
+	case C.AF_INET:
+		sin := (*C.struct_sockaddr_in)(unsafe.Pointer(sa))
+		b := (*[4]byte)(unsafe.Pointer(&sin.sin_addr))
+		return append(net.IP(nil), b[:]...).To4()
+	case C.AF_INET6:
+		sin6 := (*C.struct_sockaddr_in6)(unsafe.Pointer(sa))
+		b := (*[16]byte)(unsafe.Pointer(&sin6.sin6_addr))
+		return append(net.IP(nil), b[:]...)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,208 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Protocol selects which address families a GetAddrInfoOp resolves.
+type Protocol int
+
+const (
+	// ProtocolBoth resolves both IPv4 and IPv6 addresses.
+	ProtocolBoth Protocol = iota
+	// ProtocolIPv4 resolves only IPv4 addresses.
+	ProtocolIPv4
+	// ProtocolIPv6 resolves only IPv6 addresses.
+	ProtocolIPv6
+)
+
+// GetAddrInfoCallback reports an address found (or withdrawn) for the
+// hostname a GetAddrInfoOp is resolving. add is true when the address
+// has appeared and false when its record arrives with TTL 0 (a goodbye
+// packet); an address whose TTL lapses without a goodbye is not
+// reported as removed. more is true if additional addresses from the
+// same underlying packet are still to be delivered.
+type GetAddrInfoCallback func(op *GetAddrInfoOp, err error, add, more bool, ifIndex int, hostname string, addr net.IP, ttl uint32)
+
+// GetAddrInfoOp resolves a hostname to its A and/or AAAA addresses by
+// querying for them directly, the pure-Go equivalent of
+// DNSServiceGetAddrInfo.
+type GetAddrInfoOp struct {
+	mu     sync.Mutex
+	active bool
+	errCh  chan error
+	done   chan struct{}
+	conn   mdnsConn
+
+	ifIndex  int
+	hostname string
+	protocol Protocol
+
+	cb GetAddrInfoCallback
+}
+
+// NewGetAddrInfoOp creates a GetAddrInfoOp that will resolve hostname
+// once Started.
+func NewGetAddrInfoOp(hostname string, cb GetAddrInfoCallback) *GetAddrInfoOp {
+	return &GetAddrInfoOp{hostname: hostname, cb: cb}
+}
+
+// SetInterfaceIndex restricts resolution to a single interface. It must
+// be called before Start.
+func (op *GetAddrInfoOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetProtocol restricts resolution to IPv4-only, IPv6-only, or both (the
+// default). It must be called before Start.
+func (op *GetAddrInfoOp) SetProtocol(protocol Protocol) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.protocol = protocol
+	return nil
+}
+
+// Start begins resolution, returning ErrStarted if it is already active.
+func (op *GetAddrInfoOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	op.conn = conn
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	op.conn.Send(&message{questions: op.questions()}, nil)
+	go op.listenLoop()
+	return nil
+}
+
+func (op *GetAddrInfoOp) questions() []question {
+	var qs []question
+	if op.protocol != ProtocolIPv6 {
+		qs = append(qs, question{name: op.hostname, qtype: rrTypeA})
+	}
+	if op.protocol != ProtocolIPv4 {
+		qs = append(qs, question{name: op.hostname, qtype: rrTypeAAAA})
+	}
+	return qs
+}
+
+func (op *GetAddrInfoOp) listenLoop() {
+	for {
+		msg, _, err := op.conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		answers := append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...)
+		var matched []resourceRecord
+		var ips []net.IP
+		for _, rr := range answers {
+			if rr.name != op.hostname {
+				continue
+			}
+			var ip net.IP
+			switch {
+			case rr.rrtype == rrTypeA && op.protocol != ProtocolIPv6 && len(rr.rdata) == 4:
+				ip = net.IP(rr.rdata)
+			case rr.rrtype == rrTypeAAAA && op.protocol != ProtocolIPv4 && len(rr.rdata) == 16:
+				ip = net.IP(rr.rdata)
+			default:
+				continue
+			}
+			matched = append(matched, rr)
+			ips = append(ips, ip)
+		}
+		for i, rr := range matched {
+			more := i < len(matched)-1
+			op.cb(op, nil, rr.ttl > 0, more, op.ifIndex, rr.name, ips[i], rr.ttl)
+		}
+	}
+}
+
+// Stop cancels resolution and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *GetAddrInfoOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	op.mu.Unlock()
+	close(done)
+	conn.Close()
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when listenLoop's Recv fails on its own rather than
+// because Stop already closed conn itself. It is a no-op if Stop has
+// already deactivated the op.
+func (op *GetAddrInfoOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, false, false, op.ifIndex, op.hostname, nil, 0)
+}
+
+// Active reports whether the op is currently resolving.
+func (op *GetAddrInfoOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins resolution, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *GetAddrInfoOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts resolution and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *GetAddrInfoOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *GetAddrInfoOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
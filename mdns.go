@@ -0,0 +1,250 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// mDNS (RFC 6762) runs DNS message exchanges over these well-known
+// multicast groups and port, rather than over unicast DNS.
+const (
+	mdnsPort = 5353
+)
+
+var (
+	mdnsGroupV4 = net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+	mdnsGroupV6 = net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: mdnsPort}
+)
+
+// Resource record types this package needs to encode or decode. Others
+// are preserved as opaque rdata by decodeMessage but not interpreted.
+const (
+	rrTypeA    = 1
+	rrTypePTR  = 12
+	rrTypeTXT  = 16
+	rrTypeAAAA = 28
+	rrTypeSRV  = 33
+	rrTypeANY  = 255
+
+	rrClassIN         = 1
+	rrClassCacheFlush = 0x8000 // RFC 6762 §10.2, set on the class of a record
+	rrClassMask       = 0x7fff
+)
+
+// message is a minimal, mutable view of a DNS message sufficient for
+// mDNS probing, announcing, querying and responding: a header, a
+// question section and an answer (plus additional) section. It does
+// not model the authority section, which mDNS does not use.
+type message struct {
+	id               uint16
+	response         bool
+	truncated        bool
+	questions        []question
+	answers          []resourceRecord
+	additionalAnswer []resourceRecord
+}
+
+type question struct {
+	name  string
+	qtype uint16
+	// unicastResponse requests a unicast reply via the top bit of the
+	// class field (RFC 6762 §5.4), used for the first probe/query.
+	unicastResponse bool
+}
+
+type resourceRecord struct {
+	name        string
+	rrtype      uint16
+	cacheFlush  bool
+	ttl         uint32
+	rdata       []byte
+}
+
+var errShortMessage = errors.New("dnssd: mDNS message too short")
+
+// encode serialises m into wire format.
+func (m *message) encode() []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b[0:2], m.id)
+	var flags uint16
+	if m.response {
+		flags |= 1 << 15
+		flags |= 1 << 10 // authoritative answer, mDNS responses always are
+	}
+	binary.BigEndian.PutUint16(b[2:4], flags)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[8:10], 0)
+	binary.BigEndian.PutUint16(b[10:12], uint16(len(m.additionalAnswer)))
+
+	for _, q := range m.questions {
+		b = append(b, encodeDomainName(q.name)...)
+		qtype := make([]byte, 4)
+		binary.BigEndian.PutUint16(qtype[0:2], q.qtype)
+		class := uint16(rrClassIN)
+		if q.unicastResponse {
+			class |= rrClassCacheFlush
+		}
+		binary.BigEndian.PutUint16(qtype[2:4], class)
+		b = append(b, qtype...)
+	}
+	for _, rr := range append(append([]resourceRecord{}, m.answers...), m.additionalAnswer...) {
+		b = append(b, encodeResourceRecord(rr)...)
+	}
+	return b
+}
+
+func encodeResourceRecord(rr resourceRecord) []byte {
+	b := encodeDomainName(rr.name)
+	hdr := make([]byte, 10)
+	binary.BigEndian.PutUint16(hdr[0:2], rr.rrtype)
+	class := uint16(rrClassIN)
+	if rr.cacheFlush {
+		class |= rrClassCacheFlush
+	}
+	binary.BigEndian.PutUint16(hdr[2:4], class)
+	binary.BigEndian.PutUint32(hdr[4:8], rr.ttl)
+	binary.BigEndian.PutUint16(hdr[8:10], uint16(len(rr.rdata)))
+	b = append(b, hdr...)
+	return append(b, rr.rdata...)
+}
+
+// decodeMessage parses a wire-format mDNS message. It does not expand
+// DNS name compression pointers found in the rdata of records, only in
+// the name fields themselves, which is sufficient for the record types
+// this package produces and consumes.
+func decodeMessage(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errShortMessage
+	}
+	m := &message{
+		id:       binary.BigEndian.Uint16(b[0:2]),
+		response: binary.BigEndian.Uint16(b[2:4])&(1<<15) != 0,
+	}
+	qdcount := int(binary.BigEndian.Uint16(b[4:6]))
+	ancount := int(binary.BigEndian.Uint16(b[6:8]))
+	nscount := int(binary.BigEndian.Uint16(b[8:10]))
+	arcount := int(binary.BigEndian.Uint16(b[10:12]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, n, err := decodeDomainName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, errShortMessage
+		}
+		class := binary.BigEndian.Uint16(b[off+2 : off+4])
+		m.questions = append(m.questions, question{
+			name:            name,
+			qtype:           binary.BigEndian.Uint16(b[off : off+2]),
+			unicastResponse: class&rrClassCacheFlush != 0,
+		})
+		off += 4
+	}
+	decodeRR := func() (resourceRecord, error) {
+		name, n, err := decodeDomainName(b, off)
+		if err != nil {
+			return resourceRecord{}, err
+		}
+		off = n
+		if off+10 > len(b) {
+			return resourceRecord{}, errShortMessage
+		}
+		rrtype := binary.BigEndian.Uint16(b[off : off+2])
+		class := binary.BigEndian.Uint16(b[off+2 : off+4])
+		ttl := binary.BigEndian.Uint32(b[off+4 : off+8])
+		rdlen := int(binary.BigEndian.Uint16(b[off+8 : off+10]))
+		off += 10
+		if off+rdlen > len(b) {
+			return resourceRecord{}, errShortMessage
+		}
+		rdata := append([]byte(nil), b[off:off+rdlen]...)
+		off += rdlen
+		return resourceRecord{
+			name:       name,
+			rrtype:     rrtype,
+			cacheFlush: class&rrClassCacheFlush != 0,
+			ttl:        ttl,
+			rdata:      rdata,
+		}, nil
+	}
+	for i := 0; i < ancount; i++ {
+		rr, err := decodeRR()
+		if err != nil {
+			return nil, err
+		}
+		m.answers = append(m.answers, rr)
+	}
+	// The Authority section is not modelled (see the comment on message
+	// above); its records are parsed only to advance past them correctly.
+	for i := 0; i < nscount; i++ {
+		if _, err := decodeRR(); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < arcount; i++ {
+		rr, err := decodeRR()
+		if err != nil {
+			return nil, err
+		}
+		m.additionalAnswer = append(m.additionalAnswer, rr)
+	}
+	return m, nil
+}
+
+// decodeDomainName reads a (possibly compressed) domain name starting
+// at off, returning the dotted name and the offset just past it in the
+// original (not the pointer target).
+func decodeDomainName(b []byte, off int) (string, int, error) {
+	var labels []byte
+	minOff := off
+	jumped := false
+	end := off
+	for {
+		if off >= len(b) {
+			return "", 0, errShortMessage
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			off++
+			if !jumped {
+				end = off
+			}
+			name := string(labels)
+			if name != "" {
+				name += "."
+			}
+			return name, end, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errShortMessage
+			}
+			ptr := (l&0x3f)<<8 | int(b[off+1])
+			if !jumped {
+				end = off + 2
+				jumped = true
+			}
+			if ptr >= minOff {
+				return "", 0, errors.New("dnssd: bad mDNS name compression pointer")
+			}
+			minOff = ptr
+			off = ptr
+		default:
+			if off+1+l > len(b) {
+				return "", 0, errShortMessage
+			}
+			if len(labels) > 0 {
+				labels = append(labels, '.')
+			}
+			labels = append(labels, b[off+1:off+1+l]...)
+			off += 1 + l
+		}
+	}
+}
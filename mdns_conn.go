@@ -0,0 +1,178 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"net"
+	"sync"
+)
+
+// mdnsConn is a bidirectional multicast mDNS transport: Send multicasts
+// msg to both the IPv4 and IPv6 mDNS groups (or unicasts it, when a
+// query asked for a unicast response), and Recv delivers the next
+// inbound message. It is the seam ops use instead of talking to
+// *net.UDPConn directly, so SetBackend can substitute a fake network in
+// tests.
+type mdnsConn interface {
+	Send(msg *message, unicastTo *net.UDPAddr) error
+	Recv() (*message, *net.UDPAddr, error)
+	Close() error
+}
+
+// backend constructs the mdnsConn an op uses for the lifetime of one
+// Start/Stop cycle.
+type backend interface {
+	listen(ifIndex int) (mdnsConn, error)
+}
+
+var (
+	backendMu      sync.Mutex
+	currentBackend backend = realBackend{}
+)
+
+// SetBackend installs b as the transport every subsequently-Started op
+// uses to send and receive mDNS packets, so this package's own tests
+// can substitute an in-memory fake network instead of joining the real
+// mDNS multicast groups, which many sandboxes and CI runners block.
+// backend's method is unexported, so only code inside this package can
+// implement one. Passing nil restores the default, which multicasts on
+// UDP 5353 as RFC 6762 specifies.
+func SetBackend(b backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if b == nil {
+		b = realBackend{}
+	}
+	currentBackend = b
+}
+
+func listen(ifIndex int) (mdnsConn, error) {
+	backendMu.Lock()
+	b := currentBackend
+	backendMu.Unlock()
+	return b.listen(ifIndex)
+}
+
+// realBackend is the default backend: it joins the IPv4 and IPv6 mDNS
+// multicast groups on the requested interface (or all interfaces, for
+// InterfaceIndexAny) and multiplexes both sockets behind one mdnsConn.
+type realBackend struct{}
+
+func (realBackend) listen(ifIndex int) (mdnsConn, error) {
+	var iface *net.Interface
+	switch {
+	case ifIndex > 0:
+		ifc, err := net.InterfaceByIndex(ifIndex)
+		if err != nil {
+			return nil, err
+		}
+		iface = ifc
+	case ifIndex == InterfaceIndexLocalOnly || ifIndex == InterfaceIndexUnicast || ifIndex == InterfaceIndexP2P:
+		ifc, err := loopbackInterface()
+		if err != nil {
+			return nil, err
+		}
+		iface = ifc
+	}
+
+	pc4, err4 := net.ListenMulticastUDP("udp4", iface, &mdnsGroupV4)
+	pc6, err6 := net.ListenMulticastUDP("udp6", iface, &mdnsGroupV6)
+	if err4 != nil && err6 != nil {
+		return nil, err4
+	}
+
+	c := &realConn{pc4: pc4, pc6: pc6, msgs: make(chan rawDatagram, 32)}
+	if pc4 != nil {
+		go c.readLoop(pc4)
+	}
+	if pc6 != nil {
+		go c.readLoop(pc6)
+	}
+	return c, nil
+}
+
+type rawDatagram struct {
+	data []byte
+	addr *net.UDPAddr
+	err  error
+}
+
+type realConn struct {
+	pc4, pc6 *net.UDPConn
+	msgs     chan rawDatagram
+	closeMu  sync.Mutex
+	closed   bool
+}
+
+func (c *realConn) readLoop(pc *net.UDPConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := pc.ReadFromUDP(buf)
+		if err != nil {
+			c.msgs <- rawDatagram{err: err}
+			return
+		}
+		data := append([]byte(nil), buf[:n]...)
+		c.msgs <- rawDatagram{data: data, addr: addr}
+	}
+}
+
+func (c *realConn) Send(msg *message, unicastTo *net.UDPAddr) error {
+	b := msg.encode()
+	if unicastTo != nil {
+		pc := c.pc4
+		if unicastTo.IP.To4() == nil {
+			pc = c.pc6
+		}
+		if pc == nil {
+			return nil
+		}
+		_, err := pc.WriteToUDP(b, unicastTo)
+		return err
+	}
+	var firstErr error
+	if c.pc4 != nil {
+		if _, err := c.pc4.WriteToUDP(b, &mdnsGroupV4); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.pc6 != nil {
+		if _, err := c.pc6.WriteToUDP(b, &mdnsGroupV6); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *realConn) Recv() (*message, *net.UDPAddr, error) {
+	for {
+		d, ok := <-c.msgs
+		if !ok || d.err != nil {
+			if d.err != nil {
+				return nil, nil, d.err
+			}
+			return nil, nil, net.ErrClosed
+		}
+		msg, err := decodeMessage(d.data)
+		if err != nil {
+			continue // ignore malformed datagrams, as a real responder would
+		}
+		return msg, d.addr, nil
+	}
+}
+
+func (c *realConn) Close() error {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.pc4 != nil {
+		c.pc4.Close()
+	}
+	if c.pc6 != nil {
+		c.pc6.Close()
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"errors"
+	"net"
+)
+
+// localAddresses returns the unicast IPv4 and IPv6 addresses a
+// RegisterOp should publish A/AAAA records for: those of ifIndex, those
+// of the loopback interface when ifIndex is InterfaceIndexLocalOnly,
+// InterfaceIndexUnicast or InterfaceIndexP2P (none of which this
+// backend can honour more precisely than "don't use the network"), or
+// of every multicast-capable interface for InterfaceIndexAny.
+func localAddresses(ifIndex int) ([]net.IP, error) {
+	var ifaces []net.Interface
+	switch {
+	case ifIndex > 0:
+		iface, err := net.InterfaceByIndex(ifIndex)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = []net.Interface{*iface}
+	case ifIndex == InterfaceIndexLocalOnly || ifIndex == InterfaceIndexUnicast || ifIndex == InterfaceIndexP2P:
+		iface, err := loopbackInterface()
+		if err != nil {
+			return nil, err
+		}
+		ifaces = []net.Interface{*iface}
+	default:
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		ifaces = all
+	}
+
+	var addrs []net.IP
+	for _, iface := range ifaces {
+		isLoopback := iface.Flags&net.FlagLoopback != 0
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		// When explicitly selected, the loopback interface is exempt
+		// from the multicast-capable check: on Linux it typically lacks
+		// IFF_MULTICAST even though it is exactly what
+		// InterfaceIndexLocalOnly et al. select.
+		if !(isLoopback && ifIndex != InterfaceIndexAny) && iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipnet.IP.IsLoopback() && !isLoopback {
+				continue
+			}
+			addrs = append(addrs, ipnet.IP)
+		}
+	}
+	return addrs, nil
+}
+
+// loopbackInterface returns the host's loopback interface, the closest
+// equivalent this backend has to dns_sd.h's "local host only" and
+// "unicast"/"peer-to-peer" interface selectors, none of which name a
+// real multicast-capable interface to restrict to.
+func loopbackInterface() (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return &iface, nil
+		}
+	}
+	return nil, errors.New("dnssd: no loopback interface found")
+}
@@ -0,0 +1,445 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDatagram pairs a decoded message with the fakeConn that sent it,
+// mirroring what a real mdnsConn.Recv reports as the sender address.
+type fakeDatagram struct {
+	msg  *message
+	from *fakeConn
+}
+
+// fakeNetwork is an in-memory mdnsConn backend: every fakeConn it hands
+// out shares the same conns list, and Send on one delivers to every
+// other still-open conn, simulating a multicast medium without
+// touching real sockets. It lets tests exercise probing, announcing,
+// goodbye packets and known-answer suppression deterministically via
+// SetBackend, instead of joining the real mDNS multicast groups.
+type fakeNetwork struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+func newFakeNetwork() *fakeNetwork {
+	return &fakeNetwork{}
+}
+
+func (n *fakeNetwork) listen(ifIndex int) (mdnsConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c := &fakeConn{net: n, msgs: make(chan fakeDatagram, 64)}
+	n.conns = append(n.conns, c)
+	return c, nil
+}
+
+type fakeConn struct {
+	net    *fakeNetwork
+	msgs   chan fakeDatagram
+	closed bool
+}
+
+func (c *fakeConn) Send(msg *message, unicastTo *net.UDPAddr) error {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+	for _, other := range c.net.conns {
+		if other == c || other.closed {
+			continue
+		}
+		select {
+		case other.msgs <- fakeDatagram{msg: msg, from: c}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) Recv() (*message, *net.UDPAddr, error) {
+	d, ok := <-c.msgs
+	if !ok {
+		return nil, nil, net.ErrClosed
+	}
+	return d.msg, nil, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.msgs)
+	for i, o := range c.net.conns {
+		if o == c {
+			c.net.conns = append(c.net.conns[:i], c.net.conns[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func recvMatching(t *testing.T, msgs <-chan *message, match func(*message) bool, timeout time.Duration) *message {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-msgs:
+			if match(msg) {
+				return msg
+			}
+		case <-deadline:
+			return nil
+		}
+	}
+}
+
+func sniff(conn mdnsConn) <-chan *message {
+	msgs := make(chan *message, 16)
+	go func() {
+		for {
+			msg, _, err := conn.Recv()
+			if err != nil {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+	return msgs
+}
+
+func TestRegisterProbeTiebreak(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	name, regtype, domain, port := "conflict", "_go-dnssd._tcp", "local", 9999
+	fullname := name + "." + regtype + "." + domain + "."
+
+	peer, err := fakeNet.listen(0)
+	if err != nil {
+		t.Fatalf("peer listen: %v", err)
+	}
+	defer peer.Close()
+
+	// higher sorts lexicographically after any RDATA our registration
+	// would propose for fullname, so it must win the tiebreak.
+	higher := append([]byte{0, 0, 0xff, 0xff, 0xff, 0xff}, encodeDomainName(fullname)...)
+	go func() {
+		for {
+			msg, _, err := peer.Recv()
+			if err != nil {
+				return
+			}
+			for _, q := range msg.questions {
+				if q.name == fullname {
+					peer.Send(&message{response: true, answers: []resourceRecord{
+						{name: fullname, rrtype: rrTypeSRV, ttl: defaultTTL, rdata: higher},
+					}}, nil)
+				}
+			}
+		}
+	}()
+
+	op := NewRegisterOp(name, regtype, port, func(*RegisterOp, error, bool, string, string, string) {})
+	if err := op.SetDomain(domain); err != nil {
+		t.Fatalf("SetDomain: %v", err)
+	}
+	if err := op.SetNoAutoRename(true); err != nil {
+		t.Fatalf("SetNoAutoRename: %v", err)
+	}
+	if err := op.Start(); err != ErrNameConflict {
+		t.Fatalf("expected ErrNameConflict, got %v", err)
+	}
+}
+
+func TestRegisterProbeWinsTiebreak(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	name, regtype, domain, port := "conflict", "_go-dnssd._tcp", "local", 1
+	fullname := name + "." + regtype + "." + domain + "."
+
+	peer, err := fakeNet.listen(0)
+	if err != nil {
+		t.Fatalf("peer listen: %v", err)
+	}
+	defer peer.Close()
+
+	// lower sorts lexicographically before any RDATA our registration
+	// would propose (port 1 puts 0x00,0x01 in bytes 4:6), so it must
+	// lose the tiebreak and be ignored.
+	lower := append([]byte{0, 0, 0, 0, 0, 0}, encodeDomainName(fullname)...)
+	go func() {
+		for {
+			msg, _, err := peer.Recv()
+			if err != nil {
+				return
+			}
+			for _, q := range msg.questions {
+				if q.name == fullname {
+					peer.Send(&message{response: true, answers: []resourceRecord{
+						{name: fullname, rrtype: rrTypeSRV, ttl: defaultTTL, rdata: lower},
+					}}, nil)
+				}
+			}
+		}
+	}()
+
+	op := NewRegisterOp(name, regtype, port, func(*RegisterOp, error, bool, string, string, string) {})
+	if err := op.SetDomain(domain); err != nil {
+		t.Fatalf("SetDomain: %v", err)
+	}
+	if err := op.SetNoAutoRename(true); err != nil {
+		t.Fatalf("SetNoAutoRename: %v", err)
+	}
+	if err := op.Start(); err != nil {
+		t.Fatalf("expected to win the tiebreak and start cleanly, got %v", err)
+	}
+	op.Stop()
+}
+
+func TestRegisterAnnounceAndGoodbye(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	sniffer, err := fakeNet.listen(0)
+	if err != nil {
+		t.Fatalf("sniffer listen: %v", err)
+	}
+	defer sniffer.Close()
+	msgs := sniff(sniffer)
+
+	fullname := "ann._go-dnssd._tcp.local."
+	op := NewRegisterOp("ann", "_go-dnssd._tcp", 1234, func(*RegisterOp, error, bool, string, string, string) {})
+	if err := op.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer op.Stop()
+
+	if probe := recvMatching(t, msgs, func(m *message) bool {
+		for _, q := range m.questions {
+			if q.name == fullname {
+				return true
+			}
+		}
+		return false
+	}, time.Second); probe == nil {
+		t.Fatal("expected to observe a probe query")
+	}
+
+	if announce := recvMatching(t, msgs, func(m *message) bool {
+		if !m.response {
+			return false
+		}
+		for _, rr := range m.answers {
+			if rr.name == fullname && rr.rrtype == rrTypeSRV && rr.ttl > 0 {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second); announce == nil {
+		t.Fatal("expected an announcement with a non-zero TTL SRV record")
+	}
+
+	op.Stop()
+
+	if goodbye := recvMatching(t, msgs, func(m *message) bool {
+		if !m.response {
+			return false
+		}
+		for _, rr := range m.answers {
+			if rr.name == fullname && rr.rrtype == rrTypeSRV && rr.ttl == 0 {
+				return true
+			}
+		}
+		return false
+	}, time.Second); goodbye == nil {
+		t.Fatal("expected a goodbye packet with TTL=0 after Stop")
+	}
+}
+
+func TestBrowseKnownAnswers(t *testing.T) {
+	op := NewBrowseOp("_go-dnssd._tcp", func(*BrowseOp, error, bool, int, string, string, string) {})
+	queryName := op.queryName()
+
+	if known := op.knownAnswers(queryName); len(known) != 0 {
+		t.Fatalf("expected no known answers before any instance is known, got %v", known)
+	}
+
+	instance := "svc." + queryName
+	op.known[instance] = time.Now().Add(defaultTTL * time.Second)
+
+	known := op.knownAnswers(queryName)
+	if len(known) != 1 || known[0].name != queryName || known[0].rrtype != rrTypePTR {
+		t.Fatalf("expected one known-answer PTR record, got %+v", known)
+	}
+	got, _, err := decodeDomainName(known[0].rdata, 0)
+	if err != nil || got != instance {
+		t.Fatalf("expected known answer rdata %q, got %q (err %v)", instance, got, err)
+	}
+
+	op.known[instance] = time.Now().Add(-time.Second)
+	if known := op.knownAnswers(queryName); len(known) != 0 {
+		t.Fatalf("expected an expired instance to be dropped, got %v", known)
+	}
+}
+
+func TestBrowseKnownAnswerOnWire(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	regtype := "_go-dnssd._tcp"
+	queryName := regtype + ".local."
+	instance := "svc." + queryName
+
+	peer, err := fakeNet.listen(0)
+	if err != nil {
+		t.Fatalf("peer listen: %v", err)
+	}
+	defer peer.Close()
+
+	op := NewBrowseOp(regtype, func(*BrowseOp, error, bool, int, string, string, string) {})
+	op.known[instance] = time.Now().Add(defaultTTL * time.Second)
+	if err := op.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer op.Stop()
+
+	msg, _, err := peer.Recv()
+	if err != nil {
+		t.Fatalf("recv: %v", err)
+	}
+	if len(msg.questions) != 1 || msg.questions[0].name != queryName {
+		t.Fatalf("expected a PTR query for %q, got %+v", queryName, msg.questions)
+	}
+	if len(msg.answers) != 1 || msg.answers[0].name != queryName || msg.answers[0].rrtype != rrTypePTR {
+		t.Fatalf("expected one known-answer PTR record in the query, got %+v", msg.answers)
+	}
+	got, _, err := decodeDomainName(msg.answers[0].rdata, 0)
+	if err != nil || got != instance {
+		t.Fatalf("expected known answer rdata %q, got %q (err %v)", instance, got, err)
+	}
+}
+
+func TestBrowseRecvFailureDeactivates(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	var mu sync.Mutex
+	var gotErr error
+	op := NewBrowseOp("_go-dnssd._tcp", func(op *BrowseOp, err error, add bool, ifIndex int, name, serviceType, domain string) {
+		if err != nil {
+			mu.Lock()
+			gotErr = err
+			mu.Unlock()
+		}
+	})
+	if err := op.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	op.mu.Lock()
+	conn := op.conn
+	op.mu.Unlock()
+	conn.Close() // simulate the network failing out from under listenLoop, not a Stop
+
+	deadline := time.Now().Add(time.Second)
+	for op.Active() {
+		if time.Now().After(deadline) {
+			t.Fatal("op did not deactivate after a Recv failure")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gotErr == nil {
+		t.Fatal("expected the callback to report an error after the Recv failure")
+	}
+}
+
+func TestDecodeMessageSkipsAuthoritySection(t *testing.T) {
+	answer := resourceRecord{name: "answer.local.", rrtype: rrTypeA, ttl: 120, rdata: net.IPv4(1, 1, 1, 1).To4()}
+	authority := resourceRecord{name: "authority.local.", rrtype: rrTypeA, ttl: 120, rdata: net.IPv4(2, 2, 2, 2).To4()}
+	additional := resourceRecord{name: "additional.local.", rrtype: rrTypeA, ttl: 120, rdata: net.IPv4(3, 3, 3, 3).To4()}
+
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b[6:8], 1)   // ANCOUNT
+	binary.BigEndian.PutUint16(b[8:10], 1)  // NSCOUNT
+	binary.BigEndian.PutUint16(b[10:12], 1) // ARCOUNT
+	b = append(b, encodeResourceRecord(answer)...)
+	b = append(b, encodeResourceRecord(authority)...)
+	b = append(b, encodeResourceRecord(additional)...)
+
+	m, err := decodeMessage(b)
+	if err != nil {
+		t.Fatalf("decodeMessage: %v", err)
+	}
+	if len(m.answers) != 1 || m.answers[0].name != answer.name {
+		t.Fatalf("unexpected answers: %+v", m.answers)
+	}
+	if len(m.additionalAnswer) != 1 || m.additionalAnswer[0].name != additional.name {
+		t.Fatalf("expected the authority record to be skipped and the real additional record returned, got: %+v", m.additionalAnswer)
+	}
+}
+
+func TestQueryOneShot(t *testing.T) {
+	fakeNet := newFakeNetwork()
+	SetBackend(fakeNet)
+	defer SetBackend(nil)
+
+	peer, err := fakeNet.listen(0)
+	if err != nil {
+		t.Fatalf("peer listen: %v", err)
+	}
+	defer peer.Close()
+
+	fullname := "host.local."
+	delivered := make(chan struct{})
+	op := NewQueryOp(0, fullname, rrTypeA, rrClassIN, func(op *QueryOp, err error, add, more bool, ifIndex int, name string, rrtype, rrclass uint16, rdata []byte, ttl uint32) {
+		close(delivered)
+	})
+	if err := op.SetOneShot(true); err != nil {
+		t.Fatalf("SetOneShot: %v", err)
+	}
+	if err := op.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer op.Stop()
+
+	msg, _, err := peer.Recv()
+	if err != nil {
+		t.Fatalf("recv: %v", err)
+	}
+	if len(msg.questions) != 1 || msg.questions[0].name != fullname {
+		t.Fatalf("unexpected query: %+v", msg.questions)
+	}
+	peer.Send(&message{response: true, answers: []resourceRecord{
+		{name: fullname, rrtype: rrTypeA, ttl: 120, rdata: net.IPv4(127, 0, 0, 1).To4()},
+	}}, nil)
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("callback not invoked")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for op.Active() {
+		if time.Now().After(deadline) {
+			t.Fatal("one-shot query did not stop itself")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+#include <stdlib.h>
+
+extern void queryCallback(DNSServiceRef, DNSServiceFlags, uint32_t, DNSServiceErrorType, const char *, uint16_t, uint16_t, uint16_t, const void *, uint32_t, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// QueryCallback reports a raw resource record delivered in answer to a
+// QueryOp. more is true if additional records from the same underlying
+// packet are still to be delivered, allowing callers to defer work
+// until a batch is complete.
+type QueryCallback func(op *QueryOp, err error, add, more bool, interfaceIndex int, fullname string, rrtype, rrclass uint16, rdata []byte, ttl uint32)
+
+// QueryOp issues a raw DNS query via DNSServiceQueryRecord, bypassing
+// the service discovery record types entirely.
+type QueryOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex  int
+	fullname string
+	rrtype   uint16
+	rrclass  uint16
+	oneShot  bool
+
+	cb QueryCallback
+}
+
+// NewQueryOp creates a QueryOp that will query for fullname's rrtype
+// records in rrclass on interfaceIndex once Started.
+func NewQueryOp(interfaceIndex int, fullname string, rrtype, rrclass uint16, cb QueryCallback) *QueryOp {
+	return &QueryOp{
+		ifIndex:  interfaceIndex,
+		fullname: fullname,
+		rrtype:   rrtype,
+		rrclass:  rrclass,
+		cb:       cb,
+	}
+}
+
+// SetOneShot configures the query to stop itself once the first
+// callback invocation with more set to false has been delivered, rather
+// than continuing to listen for further answers until Stop is called
+// (the default, continuous mode). dns_sd.h has no equivalent flag, so
+// this is implemented by calling Stop from the delivering callback's
+// goroutine. It must be called before Start.
+func (op *QueryOp) SetOneShot(v bool) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.oneShot = v
+	return nil
+}
+
+// Start begins querying, returning ErrStarted if it is already active.
+func (op *QueryOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	cFullname := C.CString(op.fullname)
+	defer C.free(unsafe.Pointer(cFullname))
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceQueryRecord(&op.sdRef, 0, C.uint32_t(op.ifIndex), cFullname,
+		C.uint16_t(op.rrtype), C.uint16_t(op.rrclass),
+		C.DNSServiceQueryRecordReply(C.queryCallback), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	op.done = make(chan struct{})
+	op.mu.Lock()
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(op.sdRef, op.done)
+		op.mu.Lock()
+		op.active = false
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels the query and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *QueryOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently querying.
+func (op *QueryOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins querying, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *QueryOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts querying and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *QueryOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *QueryOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export queryCallback
+func queryCallback(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, ifIndex C.uint32_t, errorCode C.DNSServiceErrorType, fullname *C.char, rrtype, rrclass C.uint16_t, rdlen C.uint16_t, rdata unsafe.Pointer, ttl C.uint32_t, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*QueryOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	add := flags&C.kDNSServiceFlagsAdd != 0
+	more := flags&C.kDNSServiceFlagsMoreComing != 0
+	b := C.GoBytes(rdata, C.int(rdlen))
+	op.cb(op, err, add, more, int(ifIndex), C.GoString(fullname), uint16(rrtype), uint16(rrclass), b, uint32(ttl))
+	if !more && op.oneShot {
+		go op.Stop()
+	}
+}
@@ -0,0 +1,182 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"context"
+	"sync"
+)
+
+// QueryCallback reports a raw resource record delivered in answer to a
+// QueryOp. more is true if additional records from the same underlying
+// packet are still to be delivered, allowing callers to defer work
+// until a batch is complete.
+type QueryCallback func(op *QueryOp, err error, add, more bool, interfaceIndex int, fullname string, rrtype, rrclass uint16, rdata []byte, ttl uint32)
+
+// QueryOp issues a raw mDNS query and delivers every matching answer it
+// observes, the pure-Go equivalent of DNSServiceQueryRecord.
+type QueryOp struct {
+	mu     sync.Mutex
+	active bool
+	errCh  chan error
+	done   chan struct{}
+	conn   mdnsConn
+
+	ifIndex  int
+	fullname string
+	rrtype   uint16
+	rrclass  uint16
+	oneShot  bool
+
+	cb QueryCallback
+}
+
+// NewQueryOp creates a QueryOp that will query for fullname's rrtype
+// records in rrclass on interfaceIndex once Started. rrclass is
+// accepted for parity with DNSServiceQueryRecord but is not used: the
+// query is always sent for class IN (1), the only class mDNS defines,
+// answers are not filtered by class, and each is reported as class IN.
+func NewQueryOp(interfaceIndex int, fullname string, rrtype, rrclass uint16, cb QueryCallback) *QueryOp {
+	return &QueryOp{ifIndex: interfaceIndex, fullname: fullname, rrtype: rrtype, rrclass: rrclass, cb: cb}
+}
+
+// SetOneShot configures the query to stop itself once the first
+// datagram containing a matching answer has been fully delivered,
+// rather than continuing to listen for further answers until Stop is
+// called (the default, continuous mode matching DNSServiceQueryRecord).
+// It must be called before Start.
+func (op *QueryOp) SetOneShot(v bool) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.oneShot = v
+	return nil
+}
+
+// Start begins querying, returning ErrStarted if it is already active.
+func (op *QueryOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	op.conn = conn
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	conn.Send(&message{questions: []question{{name: op.fullname, qtype: op.rrtype}}}, nil)
+	go op.listenLoop(conn)
+	return nil
+}
+
+// listenLoop takes conn as a parameter, rather than reading op.conn, so
+// that a Start immediately following a Stop can't race the previous
+// Stop's goroutine over the op.conn field.
+func (op *QueryOp) listenLoop(conn mdnsConn) {
+	for {
+		msg, _, err := conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		answers := append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...)
+		matches := func(rr resourceRecord) bool {
+			return rr.name == op.fullname && (op.rrtype == rrTypeANY || rr.rrtype == op.rrtype)
+		}
+		last := -1
+		for i, rr := range answers {
+			if matches(rr) {
+				last = i
+			}
+		}
+		delivered := false
+		for i, rr := range answers {
+			if !matches(rr) {
+				continue
+			}
+			more := i < last
+			delivered = true
+			op.cb(op, nil, rr.ttl > 0, more, op.ifIndex, rr.name, rr.rrtype, rrClassIN, rr.rdata, rr.ttl)
+		}
+		if delivered && op.oneShot {
+			go op.Stop()
+			return
+		}
+	}
+}
+
+// Stop cancels the query and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *QueryOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	op.mu.Unlock()
+	close(done)
+	conn.Close()
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when listenLoop's Recv fails on its own rather than
+// because Stop already closed conn itself. It is a no-op if Stop has
+// already deactivated the op.
+func (op *QueryOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, false, false, op.ifIndex, op.fullname, op.rrtype, op.rrclass, nil, 0)
+}
+
+// Active reports whether the op is currently querying.
+func (op *QueryOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins querying, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *QueryOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts querying and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *QueryOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *QueryOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
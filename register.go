@@ -0,0 +1,332 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+#include <stdlib.h>
+
+extern void registerCallback(DNSServiceRef, DNSServiceFlags, DNSServiceErrorType, const char *, const char *, const char *, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// RegisterCallback reports the outcome of advertising a service. add is
+// true when the name has been successfully established on the network
+// and false if it is later withdrawn, e.g. because the daemon is
+// shutting down.
+type RegisterCallback func(op *RegisterOp, err error, add bool, name, serviceType, domain string)
+
+// RegisterOp advertises a service on the network via DNSServiceRegister.
+type RegisterOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex      int
+	name         string
+	regtype      string
+	domain       string
+	host         string
+	port         int
+	noAutoRename bool
+	txt          txtRecord
+	subtypes     []string
+
+	cb RegisterCallback
+}
+
+// NewRegisterOp creates a RegisterOp that will advertise name.regtype on
+// port once Started. cb is invoked from a private goroutine for as long
+// as the op is active.
+func NewRegisterOp(name, regtype string, port int, cb RegisterCallback) *RegisterOp {
+	return &RegisterOp{
+		name:    name,
+		regtype: regtype,
+		port:    port,
+		cb:      cb,
+	}
+}
+
+// SetInterfaceIndex restricts registration to a single interface,
+// otherwise interfaces are chosen by mDNSResponder. It must be called
+// before Start.
+func (op *RegisterOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetDomain overrides the domain the service is registered in. It must
+// be called before Start.
+func (op *RegisterOp) SetDomain(domain string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.domain = domain
+	return nil
+}
+
+// SetNoAutoRename disables mDNSResponder's automatic renaming of the
+// service on a name conflict. It must be called before Start.
+func (op *RegisterOp) SetNoAutoRename(v bool) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.noAutoRename = v
+	return nil
+}
+
+// SetSubtypes declares the DNS-SD subtypes (RFC 6763 §7.1) the service
+// is additionally registered under, e.g. []string{"printer"} to
+// register "_http._tcp,printer" alongside the bare "_http._tcp". Each
+// subtype must be a non-empty label of at most 63 bytes containing no
+// '.'. It must be called before Start.
+func (op *RegisterOp) SetSubtypes(subtypes []string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	for _, s := range subtypes {
+		if err := validateSubtype(s); err != nil {
+			return err
+		}
+	}
+	op.subtypes = subtypes
+	return nil
+}
+
+// fullRegtype returns the service type DNSServiceRegister should be
+// called with: regtype, followed by any declared subtypes joined with
+// commas per RFC 6763 §7.1.
+func (op *RegisterOp) fullRegtype() string {
+	if len(op.subtypes) == 0 {
+		return op.regtype
+	}
+	return op.regtype + "," + strings.Join(op.subtypes, ",")
+}
+
+// SetTXTPair sets key=value in the service's TXT record, replacing any
+// existing value for key. It returns ErrTXTStringLen or ErrTXTLen if
+// the pair cannot be added without violating the RFC 6763 §6.1 limits.
+func (op *RegisterOp) SetTXTPair(key, value string) error {
+	return op.txt.set(key, value)
+}
+
+// SetTXTFlag sets key in the service's TXT record as a bare attribute,
+// with no '=', per the RFC 6763 §6.4 boolean convention.
+func (op *RegisterOp) SetTXTFlag(key string) error {
+	return op.txt.setFlag(key)
+}
+
+// SetTXTEmpty sets key in the service's TXT record with an explicitly
+// empty value ("key="), distinct from SetTXTFlag's bare attribute.
+func (op *RegisterOp) SetTXTEmpty(key string) error {
+	return op.txt.setEmpty(key)
+}
+
+// SetTXTBytes sets key's value to arbitrary binary octets, per RFC 6763
+// §6.5, rather than the UTF-8 text SetTXTPair assumes.
+func (op *RegisterOp) SetTXTBytes(key string, v []byte) error {
+	return op.txt.setBytes(key, v)
+}
+
+// DeleteTXTPair removes key from the service's TXT record, if present.
+func (op *RegisterOp) DeleteTXTPair(key string) error {
+	if err := op.txt.delete(key); err != nil && err != errTXTKeyNotPresent {
+		return err
+	}
+	return nil
+}
+
+// SubtypeRecord identifies a subtype dynamically added to a running
+// RegisterOp by AddSubtypeRecord, for later removal with
+// RemoveSubtypeRecord.
+type SubtypeRecord struct {
+	subtype string
+}
+
+// AddSubtypeRecord advertises an additional subtype for an
+// already-started registration. dns_sd.h has no API for adding a
+// subtype PTR record under a name other than the service's own, so this
+// re-registers the service with subtype appended to its subtype list,
+// the same way SetSubtypes would have composed it before Start. It
+// returns a handle that RemoveSubtypeRecord accepts to withdraw the
+// subtype again.
+func (op *RegisterOp) AddSubtypeRecord(subtype string) (*SubtypeRecord, error) {
+	if !op.Active() {
+		return nil, ErrNotStarted
+	}
+	if err := validateSubtype(subtype); err != nil {
+		return nil, err
+	}
+	op.subtypes = append(op.subtypes, subtype)
+	if err := op.register(); err != nil {
+		return nil, err
+	}
+	return &SubtypeRecord{subtype: subtype}, nil
+}
+
+// RemoveSubtypeRecord withdraws a subtype previously added with
+// AddSubtypeRecord by re-registering without it.
+func (op *RegisterOp) RemoveSubtypeRecord(rec *SubtypeRecord) error {
+	if !op.Active() {
+		return ErrNotStarted
+	}
+	for i, s := range op.subtypes {
+		if s == rec.subtype {
+			op.subtypes = append(op.subtypes[:i], op.subtypes[i+1:]...)
+			break
+		}
+	}
+	return op.register()
+}
+
+// Start begins advertising the service, returning ErrStarted if it is
+// already active.
+func (op *RegisterOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	return op.register()
+}
+
+// register calls DNSServiceRegister with the op's current fullRegtype,
+// tearing down any previous registration first. Start uses it to begin
+// advertising; AddSubtypeRecord and RemoveSubtypeRecord use it to
+// re-advertise under an updated subtype list without otherwise
+// disturbing the op.
+func (op *RegisterOp) register() error {
+	op.mu.Lock()
+	wasActive := op.active
+	if wasActive {
+		op.active = false
+	}
+	op.mu.Unlock()
+	if wasActive {
+		close(op.done)
+		C.DNSServiceRefDeallocate(op.sdRef)
+		op.handle.Delete()
+	}
+
+	var flags C.DNSServiceFlags
+	if op.noAutoRename {
+		flags |= C.kDNSServiceFlagsNoAutoRename
+	}
+
+	cName := C.CString(op.name)
+	defer C.free(unsafe.Pointer(cName))
+	cRegtype := C.CString(op.fullRegtype())
+	defer C.free(unsafe.Pointer(cRegtype))
+	var cDomain *C.char
+	if op.domain != "" {
+		cDomain = C.CString(op.domain)
+		defer C.free(unsafe.Pointer(cDomain))
+	}
+
+	var txtPtr unsafe.Pointer
+	if op.txt.l > 0 {
+		txtPtr = unsafe.Pointer(&op.txt.b[0])
+	}
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceRegister(&op.sdRef, flags, C.uint32_t(op.ifIndex), cName, cRegtype, cDomain, nil,
+		C.uint16_t(htons(op.port)), C.uint16_t(op.txt.l), txtPtr,
+		C.DNSServiceRegisterReply(C.registerCallback), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	// The goroutine works on its own sdRef and done, and only marks the
+	// op inactive if no later register call has replaced them.
+	sdRef, done := op.sdRef, make(chan struct{})
+	op.mu.Lock()
+	op.done = done
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(sdRef, done)
+		op.mu.Lock()
+		if op.done == done {
+			op.active = false
+		}
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop withdraws the service advertisement and releases the op's
+// underlying resources. It is a no-op if the op is not active.
+func (op *RegisterOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently advertising.
+func (op *RegisterOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins advertising the service, as Start, and arranges
+// for Stop to be called automatically when ctx is cancelled or its
+// deadline expires.
+func (op *RegisterOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts advertising the service and blocks until ctx is done or
+// the callback delivers an error, stopping the op before returning.
+func (op *RegisterOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *RegisterOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export registerCallback
+func registerCallback(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, errorCode C.DNSServiceErrorType, name, regtype, domain *C.char, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*RegisterOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	add := flags&C.kDNSServiceFlagsAdd != 0
+	op.cb(op, err, add, C.GoString(name), C.GoString(regtype), C.GoString(domain))
+}
+
+// htons converts a host-order port number into the network byte order
+// dns_sd.h expects for the port argument to DNSServiceRegister.
+func htons(port int) uint16 {
+	return uint16(port)<<8 | uint16(port)>>8
+}
@@ -0,0 +1,525 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNameConflict is returned by Start when probing (RFC 6762 §8.1)
+// finds the service name already claimed on the network and the op was
+// configured with SetNoAutoRename(true), so it cannot be renamed
+// automatically to resolve the conflict.
+var ErrNameConflict = errors.New("dnssd: name already in use")
+
+// Probing, announcing and record TTLs follow RFC 6762 §8.1, §8.3 and
+// §10 respectively.
+const (
+	probeCount        = 3
+	probeInterval     = 250 * time.Millisecond
+	announceCount     = 2
+	announceInterval  = time.Second
+	defaultTTL        = 120
+	maxRenameAttempts = 100
+)
+
+// RegisterCallback reports the outcome of advertising a service. add is
+// true when the name has been successfully established on the network
+// and false if it is later withdrawn, e.g. because Stop sent a goodbye
+// packet.
+type RegisterCallback func(op *RegisterOp, err error, add bool, name, serviceType, domain string)
+
+// RegisterOp advertises a service on the network by responding to mDNS
+// queries directly, the pure-Go equivalent of DNSServiceRegister.
+type RegisterOp struct {
+	mu        sync.Mutex
+	active    bool
+	errCh     chan error
+	done      chan struct{}
+	conn      mdnsConn
+	published []resourceRecord
+
+	ifIndex      int
+	name         string
+	regtype      string
+	domain       string
+	port         int
+	noAutoRename bool
+	txt          txtRecord
+	subtypes     []string
+
+	cb RegisterCallback
+}
+
+// NewRegisterOp creates a RegisterOp that will advertise name.regtype on
+// port once Started. cb is invoked from a private goroutine for as long
+// as the op is active.
+func NewRegisterOp(name, regtype string, port int, cb RegisterCallback) *RegisterOp {
+	return &RegisterOp{name: name, regtype: regtype, port: port, cb: cb}
+}
+
+// SetInterfaceIndex restricts registration to a single interface,
+// otherwise all multicast-capable interfaces are used. It must be
+// called before Start.
+func (op *RegisterOp) SetInterfaceIndex(ifIndex int) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.ifIndex = ifIndex
+	return nil
+}
+
+// SetDomain overrides the domain the service is registered in,
+// "local" by default. It must be called before Start.
+func (op *RegisterOp) SetDomain(domain string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.domain = domain
+	return nil
+}
+
+// SetNoAutoRename disables automatically renaming the service on a name
+// conflict found while probing. It must be called before Start.
+func (op *RegisterOp) SetNoAutoRename(v bool) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	op.noAutoRename = v
+	return nil
+}
+
+// SetSubtypes declares the DNS-SD subtypes (RFC 6763 §7.1) the service
+// is additionally discoverable under. Each subtype must be a non-empty
+// label of at most 63 bytes containing no '.'. It must be called
+// before Start.
+func (op *RegisterOp) SetSubtypes(subtypes []string) error {
+	if op.Active() {
+		return ErrStarted
+	}
+	for _, s := range subtypes {
+		if err := validateSubtype(s); err != nil {
+			return err
+		}
+	}
+	op.subtypes = subtypes
+	return nil
+}
+
+// fullRegtype returns regtype followed by any declared subtypes joined
+// with commas, the same form the dns_sd.h backend passes to
+// DNSServiceRegister. The pure-Go backend itself does not use it: it
+// publishes each subtype as a separate PTR record (see records).
+func (op *RegisterOp) fullRegtype() string {
+	if len(op.subtypes) == 0 {
+		return op.regtype
+	}
+	return op.regtype + "," + strings.Join(op.subtypes, ",")
+}
+
+// SetTXTPair sets key=value in the service's TXT record, replacing any
+// existing value for key. It returns ErrTXTStringLen or ErrTXTLen if
+// the pair cannot be added without violating the RFC 6763 §6.1 limits.
+func (op *RegisterOp) SetTXTPair(key, value string) error {
+	return op.txt.set(key, value)
+}
+
+// SetTXTFlag sets key in the service's TXT record as a bare attribute,
+// with no '=', per the RFC 6763 §6.4 boolean convention.
+func (op *RegisterOp) SetTXTFlag(key string) error {
+	return op.txt.setFlag(key)
+}
+
+// SetTXTEmpty sets key in the service's TXT record with an explicitly
+// empty value ("key="), distinct from SetTXTFlag's bare attribute.
+func (op *RegisterOp) SetTXTEmpty(key string) error {
+	return op.txt.setEmpty(key)
+}
+
+// SetTXTBytes sets key's value to arbitrary binary octets, per RFC 6763
+// §6.5, rather than the UTF-8 text SetTXTPair assumes.
+func (op *RegisterOp) SetTXTBytes(key string, v []byte) error {
+	return op.txt.setBytes(key, v)
+}
+
+// DeleteTXTPair removes key from the service's TXT record, if present.
+func (op *RegisterOp) DeleteTXTPair(key string) error {
+	if err := op.txt.delete(key); err != nil && err != errTXTKeyNotPresent {
+		return err
+	}
+	return nil
+}
+
+// SubtypeRecord identifies a subtype PTR record dynamically added to a
+// running RegisterOp by AddSubtypeRecord, for later removal with
+// RemoveSubtypeRecord.
+type SubtypeRecord struct {
+	rr resourceRecord
+}
+
+// AddSubtypeRecord advertises an additional subtype for an
+// already-started registration by announcing its PTR record directly,
+// without restarting probing. It returns a handle that
+// RemoveSubtypeRecord accepts to withdraw the subtype again.
+func (op *RegisterOp) AddSubtypeRecord(subtype string) (*SubtypeRecord, error) {
+	if !op.Active() {
+		return nil, ErrNotStarted
+	}
+	if err := validateSubtype(subtype); err != nil {
+		return nil, err
+	}
+	rr := resourceRecord{
+		name:   subtype + "._sub." + op.regtype + "." + op.domainOrDefault() + ".",
+		rrtype: rrTypePTR,
+		ttl:    defaultTTL,
+		rdata:  encodeDomainName(op.fullname()),
+	}
+	op.mu.Lock()
+	op.published = append(op.published, rr)
+	conn := op.conn
+	op.mu.Unlock()
+	if err := conn.Send(&message{response: true, answers: []resourceRecord{rr}}, nil); err != nil {
+		return nil, err
+	}
+	return &SubtypeRecord{rr: rr}, nil
+}
+
+// RemoveSubtypeRecord withdraws a subtype previously added with
+// AddSubtypeRecord by sending a goodbye packet (TTL=0) for its record.
+func (op *RegisterOp) RemoveSubtypeRecord(rec *SubtypeRecord) error {
+	if !op.Active() {
+		return ErrNotStarted
+	}
+	op.mu.Lock()
+	for i, rr := range op.published {
+		if rr.name == rec.rr.name && rr.rrtype == rec.rr.rrtype {
+			op.published = append(op.published[:i], op.published[i+1:]...)
+			break
+		}
+	}
+	conn := op.conn
+	op.mu.Unlock()
+	goodbye := rec.rr
+	goodbye.ttl = 0
+	return conn.Send(&message{response: true, answers: []resourceRecord{goodbye}}, nil)
+}
+
+func (op *RegisterOp) domainOrDefault() string {
+	if op.domain == "" {
+		return "local"
+	}
+	return op.domain
+}
+
+func (op *RegisterOp) fullname() string {
+	return op.name + "." + op.regtype + "." + op.domainOrDefault() + "."
+}
+
+// Start probes for the service name, returning ErrStarted if it is
+// already active. Start returns as soon as probing (RFC 6762 §8.1) has
+// confirmed the name is free, matching the cgo backend's Start/Stop
+// contract of returning immediately; announcing (§8.3) continues in the
+// background and the callback's initial "add" report follows once the
+// first announcement has gone out.
+func (op *RegisterOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+	addrs, err := localAddresses(op.ifIndex)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	name := op.name
+	for attempt := 0; ; attempt++ {
+		ok, err := op.probe(conn, name)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if ok {
+			break
+		}
+		if op.noAutoRename || attempt >= maxRenameAttempts {
+			conn.Close()
+			return ErrNameConflict
+		}
+		name = fmt.Sprintf("%s (%d)", op.name, attempt+2)
+	}
+	op.name = name
+	records := op.records(addrs)
+
+	op.mu.Lock()
+	op.conn = conn
+	op.published = records
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	go op.respondLoop()
+	go op.announce(records)
+
+	return nil
+}
+
+// announce sends announceCount announcement packets announceInterval
+// apart (RFC 6762 §8.3) in the background, delivering the "add" report
+// once the first has gone out. It exits early, without reporting
+// anything further, if Stop runs while it is still sleeping between
+// announcements.
+func (op *RegisterOp) announce(records []resourceRecord) {
+	for i := 0; i < announceCount; i++ {
+		if i > 0 {
+			time.Sleep(announceInterval)
+		}
+		op.mu.Lock()
+		conn := op.conn
+		active := op.active
+		op.mu.Unlock()
+		if !active {
+			return
+		}
+		if err := conn.Send(&message{response: true, answers: records}, nil); err != nil {
+			return
+		}
+		if i == 0 {
+			op.cb(op, nil, true, op.name, op.regtype, op.domainOrDefault())
+		}
+	}
+}
+
+// probe sends up to probeCount probe queries for name, probeInterval
+// apart, to check the name isn't already in use. It returns false if a
+// peer's record for that name wins the RFC 6762 §8.2 tiebreak.
+//
+// Tiebreaking compares the peer's RDATA against ourRData, the SRV
+// record this registration would itself publish for name: a peer's
+// record that sorts lexicographically after ours beats us, so probing
+// fails and the name must be renamed or reported as conflicting; one
+// that sorts before or equal to ours loses (or is the very record we'd
+// publish, looped back), so it's ignored and probing continues.
+func (op *RegisterOp) probe(conn mdnsConn, name string) (bool, error) {
+	fullname := name + "." + op.regtype + "." + op.domainOrDefault() + "."
+	ourRData := op.srvRData(fullname)
+
+	msgs := make(chan *message, 16)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			msg, _, err := conn.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer close(stop)
+
+	q := question{name: fullname, qtype: rrTypeANY, unicastResponse: true}
+	for i := 0; i < probeCount; i++ {
+		if err := conn.Send(&message{questions: []question{q}}, nil); err != nil {
+			return false, err
+		}
+		deadline := time.After(probeInterval)
+	wait:
+		for {
+			select {
+			case msg := <-msgs:
+				for _, rr := range append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...) {
+					if rr.name == fullname && bytes.Compare(rr.rdata, ourRData) > 0 {
+						return false, nil
+					}
+				}
+			case <-deadline:
+				break wait
+			}
+		}
+	}
+	return true, nil
+}
+
+// srvRData builds the SRV record payload this registration would
+// advertise for fullname: records uses it to publish the record, and
+// probe uses it as this host's side of the RFC 6762 §8.2 RDATA
+// tiebreak.
+func (op *RegisterOp) srvRData(fullname string) []byte {
+	srv := make([]byte, 6) // priority, weight, port
+	binary.BigEndian.PutUint16(srv[4:6], uint16(op.port))
+	return append(srv, encodeDomainName(fullname)...)
+}
+
+// records builds the PTR, subtype PTR, SRV, TXT and address records
+// this registration answers queries with.
+func (op *RegisterOp) records(addrs []net.IP) []resourceRecord {
+	fullname := op.fullname()
+	base := op.regtype + "." + op.domainOrDefault() + "."
+
+	rrs := []resourceRecord{
+		{name: base, rrtype: rrTypePTR, ttl: defaultTTL, rdata: encodeDomainName(fullname)},
+	}
+	for _, st := range op.subtypes {
+		rrs = append(rrs, resourceRecord{
+			name:   st + "._sub." + base,
+			rrtype: rrTypePTR,
+			ttl:    defaultTTL,
+			rdata:  encodeDomainName(fullname),
+		})
+	}
+
+	rrs = append(rrs, resourceRecord{name: fullname, rrtype: rrTypeSRV, cacheFlush: true, ttl: defaultTTL, rdata: op.srvRData(fullname)})
+
+	txt := op.txt.b
+	if len(txt) == 0 {
+		txt = []byte{0}
+	}
+	rrs = append(rrs, resourceRecord{name: fullname, rrtype: rrTypeTXT, cacheFlush: true, ttl: defaultTTL, rdata: txt})
+
+	for _, ip := range addrs {
+		if ip4 := ip.To4(); ip4 != nil {
+			rrs = append(rrs, resourceRecord{name: fullname, rrtype: rrTypeA, cacheFlush: true, ttl: defaultTTL, rdata: ip4})
+		} else if ip16 := ip.To16(); ip16 != nil {
+			rrs = append(rrs, resourceRecord{name: fullname, rrtype: rrTypeAAAA, cacheFlush: true, ttl: defaultTTL, rdata: ip16})
+		}
+	}
+	return rrs
+}
+
+// respondLoop answers incoming queries that match this registration's
+// records until the op is stopped, at which point Stop closes conn and
+// Recv returns an error, ending the loop.
+func (op *RegisterOp) respondLoop() {
+	for {
+		msg, addr, err := op.conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		if msg.response {
+			continue
+		}
+		op.mu.Lock()
+		published := op.published
+		op.mu.Unlock()
+
+		var matched []resourceRecord
+		for _, q := range msg.questions {
+			for _, rr := range published {
+				if rr.name == q.name && (q.qtype == rrTypeANY || q.qtype == rr.rrtype) {
+					matched = append(matched, rr)
+				}
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		var unicastTo *net.UDPAddr
+		for _, q := range msg.questions {
+			if q.unicastResponse {
+				unicastTo = addr
+				break
+			}
+		}
+		op.conn.Send(&message{response: true, answers: matched}, unicastTo)
+	}
+}
+
+// Stop withdraws the service advertisement with a goodbye packet
+// (TTL=0 answers, RFC 6762 §10.1) and releases the op's underlying
+// resources. It is a no-op if the op is not active.
+func (op *RegisterOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	published := op.published
+	done := op.done
+	op.mu.Unlock()
+
+	goodbye := make([]resourceRecord, len(published))
+	for i, rr := range published {
+		goodbye[i] = rr
+		goodbye[i].ttl = 0
+	}
+	conn.Send(&message{response: true, answers: goodbye}, nil)
+	close(done)
+	conn.Close()
+	op.cb(op, nil, false, op.name, op.regtype, op.domainOrDefault())
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when respondLoop's Recv fails on its own -- e.g. the
+// network interface disappearing -- rather than because Stop already
+// closed conn itself. It is a no-op if Stop has already deactivated the
+// op, so the two can never both report.
+func (op *RegisterOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, false, op.name, op.regtype, op.domainOrDefault())
+}
+
+// Active reports whether the op is currently advertising.
+func (op *RegisterOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins advertising the service, as Start, and arranges
+// for Stop to be called automatically when ctx is cancelled or its
+// deadline expires.
+func (op *RegisterOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts advertising the service and blocks until ctx is done or
+// the callback delivers an error, stopping the op before returning.
+func (op *RegisterOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *RegisterOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
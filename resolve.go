@@ -0,0 +1,154 @@
+//go:build !dnssd_pure
+
+package dnssd
+
+/*
+#include <dns_sd.h>
+#include <stdlib.h>
+
+extern void resolveCallback(DNSServiceRef, DNSServiceFlags, uint32_t, DNSServiceErrorType, const char *, const char *, uint16_t, uint16_t, const unsigned char *, void *);
+*/
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// ResolveCallback reports the host, port and TXT record of a service
+// instance previously found by a BrowseOp. txt is the pre-existing
+// collapsed view of the TXT record, kept for backwards compatibility;
+// record is the same TXT record parsed without collapsing the
+// distinction between an absent key, a bare flag, and a present but
+// empty value (RFC 6763 §6).
+type ResolveCallback func(op *ResolveOp, err error, host string, port int, txt map[string]string, record TXTRecord)
+
+// ResolveOp resolves a service instance name to a target host, port and
+// TXT record via DNSServiceResolve.
+type ResolveOp struct {
+	mu     sync.Mutex
+	sdRef  C.DNSServiceRef
+	handle cgo.Handle
+	done   chan struct{}
+	active bool
+	errCh  chan error
+
+	ifIndex int
+	name    string
+	regtype string
+	domain  string
+
+	cb ResolveCallback
+}
+
+// NewResolveOp creates a ResolveOp that will resolve name.regtype.domain
+// on interfaceIndex once Started.
+func NewResolveOp(interfaceIndex int, name, regtype, domain string, cb ResolveCallback) *ResolveOp {
+	return &ResolveOp{
+		ifIndex: interfaceIndex,
+		name:    name,
+		regtype: regtype,
+		domain:  domain,
+		cb:      cb,
+	}
+}
+
+// Start begins resolution, returning ErrStarted if it is already active.
+func (op *ResolveOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+
+	cName := C.CString(op.name)
+	defer C.free(unsafe.Pointer(cName))
+	cRegtype := C.CString(op.regtype)
+	defer C.free(unsafe.Pointer(cRegtype))
+	cDomain := C.CString(op.domain)
+	defer C.free(unsafe.Pointer(cDomain))
+
+	op.handle = cgo.NewHandle(op)
+	ec := C.DNSServiceResolve(&op.sdRef, 0, C.uint32_t(op.ifIndex), cName, cRegtype, cDomain,
+		C.DNSServiceResolveReply(C.resolveCallback), unsafe.Pointer(op.handle))
+	if ec != C.kDNSServiceErr_NoError {
+		op.handle.Delete()
+		return newError(ec)
+	}
+
+	op.done = make(chan struct{})
+	op.mu.Lock()
+	op.active = true
+	op.mu.Unlock()
+	go func() {
+		run(op.sdRef, op.done)
+		op.mu.Lock()
+		op.active = false
+		op.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop cancels resolution and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *ResolveOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	op.mu.Unlock()
+	close(op.done)
+	C.DNSServiceRefDeallocate(op.sdRef)
+	op.handle.Delete()
+}
+
+// Active reports whether the op is currently resolving.
+func (op *ResolveOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins resolution, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *ResolveOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts resolution and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *ResolveOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *ResolveOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
+
+//export resolveCallback
+func resolveCallback(sdRef C.DNSServiceRef, flags C.DNSServiceFlags, ifIndex C.uint32_t, errorCode C.DNSServiceErrorType, fullname, hosttarget *C.char, port C.uint16_t, txtLen C.uint16_t, txtBytes *C.uchar, goCtx unsafe.Pointer) {
+	op := cgo.Handle(uintptr(goCtx)).Value().(*ResolveOp)
+	err := newError(errorCode)
+	if err != nil && op.errCh != nil {
+		select {
+		case op.errCh <- err:
+		default:
+		}
+	}
+	b := C.GoBytes(unsafe.Pointer(txtBytes), C.int(txtLen))
+	record := decodeTxt(b)
+	op.cb(op, err, C.GoString(hosttarget), int(ntohs(uint16(port))), record.Map(), record)
+}
+
+// ntohs converts a network-order port number, as delivered by
+// DNSServiceResolve's callback, into host order.
+func ntohs(port uint16) uint16 {
+	return port<<8 | port>>8
+}
@@ -0,0 +1,214 @@
+//go:build dnssd_pure
+
+package dnssd
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// ResolveCallback reports the host, port and TXT record of a service
+// instance previously found by a BrowseOp. txt is the pre-existing
+// collapsed view of the TXT record, kept for backwards compatibility;
+// record is the same TXT record parsed without collapsing the RFC 6763
+// §6 distinction between an absent key, a bare flag, and a present but
+// empty value.
+type ResolveCallback func(op *ResolveOp, err error, host string, port int, txt map[string]string, record TXTRecord)
+
+// ResolveOp resolves a service instance name to a target host, port and
+// TXT record by querying for its SRV and TXT records, the pure-Go
+// equivalent of DNSServiceResolve.
+type ResolveOp struct {
+	mu     sync.Mutex
+	active bool
+	errCh  chan error
+	done   chan struct{}
+	conn   mdnsConn
+
+	ifIndex int
+	name    string
+	regtype string
+	domain  string
+
+	cb ResolveCallback
+}
+
+// NewResolveOp creates a ResolveOp that will resolve name.regtype.domain
+// on interfaceIndex once Started.
+func NewResolveOp(interfaceIndex int, name, regtype, domain string, cb ResolveCallback) *ResolveOp {
+	return &ResolveOp{ifIndex: interfaceIndex, name: name, regtype: regtype, domain: domain, cb: cb}
+}
+
+func (op *ResolveOp) fullname() string {
+	domain := op.domain
+	if domain == "" {
+		domain = "local"
+	}
+	return op.name + "." + op.regtype + "." + domain + "."
+}
+
+// Start begins resolution, returning ErrStarted if it is already active.
+func (op *ResolveOp) Start() error {
+	if op.Active() {
+		return ErrStarted
+	}
+	conn, err := listen(op.ifIndex)
+	if err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	op.conn = conn
+	op.done = make(chan struct{})
+	op.active = true
+	op.mu.Unlock()
+
+	go op.queryLoop(conn)
+	go op.listenLoop(conn)
+	return nil
+}
+
+// queryLoop and listenLoop take conn as a parameter, rather than
+// reading op.conn, so that a Start immediately following a Stop can't
+// race the previous Stop's goroutines over the op.conn field: each
+// goroutine pair only ever touches the mdnsConn it was handed.
+func (op *ResolveOp) queryLoop(conn mdnsConn) {
+	fullname := op.fullname()
+	conn.Send(&message{questions: []question{
+		{name: fullname, qtype: rrTypeSRV},
+		{name: fullname, qtype: rrTypeTXT},
+	}}, nil)
+}
+
+func (op *ResolveOp) listenLoop(conn mdnsConn) {
+	fullname := op.fullname()
+	var host string
+	var port int
+	var haveSRV bool
+	var txt TXTRecord
+	var txtRaw []byte
+	var haveTXT bool
+	var delivered bool
+	var lastHost string
+	var lastPort int
+	var lastTXTRaw []byte
+
+	// deliver reports the resolved host/port/TXT once both records have
+	// been seen, and again whenever a later packet (e.g. a re-announce,
+	// RFC 6762 §8.3) changes one of them, but not on every repeat of an
+	// unchanged answer.
+	deliver := func() {
+		if !haveSRV || !haveTXT {
+			return
+		}
+		if delivered && host == lastHost && port == lastPort && bytes.Equal(txtRaw, lastTXTRaw) {
+			return
+		}
+		delivered = true
+		lastHost, lastPort, lastTXTRaw = host, port, txtRaw
+		op.cb(op, nil, host, port, txt.Map(), txt)
+	}
+
+	for {
+		msg, _, err := conn.Recv()
+		if err != nil {
+			op.recvFailed(err)
+			return
+		}
+		for _, rr := range append(append([]resourceRecord{}, msg.answers...), msg.additionalAnswer...) {
+			if rr.name != fullname {
+				continue
+			}
+			switch rr.rrtype {
+			case rrTypeSRV:
+				if len(rr.rdata) < 6 {
+					continue
+				}
+				target, _, err := decodeDomainName(rr.rdata, 6)
+				if err != nil {
+					continue
+				}
+				host = target
+				port = int(rr.rdata[4])<<8 | int(rr.rdata[5])
+				haveSRV = true
+			case rrTypeTXT:
+				txt = decodeTxt(rr.rdata)
+				txtRaw = rr.rdata
+				haveTXT = true
+			}
+		}
+		deliver()
+	}
+}
+
+// Stop cancels resolution and releases the op's underlying resources.
+// It is a no-op if the op is not active.
+func (op *ResolveOp) Stop() {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	op.mu.Unlock()
+	close(done)
+	conn.Close()
+}
+
+// recvFailed marks the op inactive and reports err through errCh and
+// the callback when listenLoop's Recv fails on its own rather than
+// because Stop already closed conn itself. It is a no-op if Stop has
+// already deactivated the op.
+func (op *ResolveOp) recvFailed(err error) {
+	op.mu.Lock()
+	if !op.active {
+		op.mu.Unlock()
+		return
+	}
+	op.active = false
+	conn := op.conn
+	done := op.done
+	errCh := op.errCh
+	op.mu.Unlock()
+
+	close(done)
+	conn.Close()
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	op.cb(op, err, "", 0, nil, TXTRecord{})
+}
+
+// Active reports whether the op is currently resolving.
+func (op *ResolveOp) Active() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.active
+}
+
+// StartContext begins resolution, as Start, and arranges for Stop to be
+// called automatically when ctx is cancelled or its deadline expires.
+func (op *ResolveOp) StartContext(ctx context.Context) error {
+	return startContext(ctx, op)
+}
+
+// Run starts resolution and blocks until ctx is done or the callback
+// delivers an error, stopping the op before returning.
+func (op *ResolveOp) Run(ctx context.Context) error {
+	return runContext(ctx, op)
+}
+
+func (op *ResolveOp) errChan() chan error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.errCh == nil {
+		op.errCh = make(chan error, 1)
+	}
+	return op.errCh
+}
@@ -0,0 +1,30 @@
+package dnssd
+
+import "strings"
+
+// validateSubtype checks a DNS-SD subtype label against RFC 6763 §7.1:
+// it must be non-empty, no more than 63 bytes (the DNS label length
+// limit), and contain no '.' so it can't be mistaken for a multi-label
+// name or split across two.
+func validateSubtype(s string) error {
+	if s == "" || len(s) > 63 || strings.ContainsRune(s, '.') {
+		return ErrInvalidSubtype
+	}
+	return nil
+}
+
+// encodeDomainName converts a dotted domain name into wire-format DNS
+// labels (a sequence of length-prefixed segments terminated by a zero
+// length byte), as the pure-Go backend uses for names in mDNS messages
+// and for PTR and SRV record rdata.
+func encodeDomainName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
@@ -0,0 +1,196 @@
+package dnssd
+
+import (
+	"errors"
+	"strings"
+)
+
+// errTXTKeyNotPresent is an internal sentinel distinguishing "key not
+// found" from real encoding errors inside txtRecord.delete; it never
+// escapes the package.
+var errTXTKeyNotPresent = errors.New("dnssd: TXT key not present")
+
+// txtRecord holds a TXT record being built up for a RegisterOp, encoded
+// in the wire format DNSServiceRegister expects: a sequence of
+// length-prefixed strings. l tracks the total encoded length so callers
+// can be rejected before dns_sd.h would reject them.
+type txtRecord struct {
+	b       []byte
+	offsets map[string]int
+	l       int
+}
+
+// setRaw writes content (the full "key", "key=" or "key=value" bytes)
+// as key's entry, replacing any existing entry for key. Keys are
+// case-insensitive per RFC 6763 §6.4, matching the read side's
+// strings.ToLower in decodeTxt/TXTRecord.Get. It enforces the RFC 6763
+// §6.1 limits: at most 255 bytes of content per entry, and at most
+// 65535 bytes total.
+func (r *txtRecord) setRaw(key string, content []byte) error {
+	if len(content) > 255 {
+		return ErrTXTStringLen
+	}
+	if err := r.delete(key); err != nil && err != errTXTKeyNotPresent {
+		return err
+	}
+	if r.l+1+len(content) > 65535 {
+		return ErrTXTLen
+	}
+	if r.offsets == nil {
+		r.offsets = make(map[string]int)
+	}
+	entry := make([]byte, 0, 1+len(content))
+	entry = append(entry, byte(len(content)))
+	entry = append(entry, content...)
+	r.offsets[strings.ToLower(key)] = len(r.b)
+	r.b = append(r.b, entry...)
+	r.l += 1 + len(content)
+	return nil
+}
+
+// set encodes "key=value" as key's entry.
+func (r *txtRecord) set(key, value string) error {
+	content := make([]byte, 0, len(key)+1+len(value))
+	content = append(content, key...)
+	content = append(content, '=')
+	content = append(content, value...)
+	return r.setRaw(key, content)
+}
+
+// setFlag encodes the bare attribute "key", with no '=', as key's entry.
+func (r *txtRecord) setFlag(key string) error {
+	return r.setRaw(key, []byte(key))
+}
+
+// setEmpty encodes "key=", an explicitly empty value, as key's entry.
+func (r *txtRecord) setEmpty(key string) error {
+	return r.setRaw(key, append([]byte(key), '='))
+}
+
+// setBytes encodes "key=" followed by arbitrary binary octets as key's
+// entry, per RFC 6763 §6.5.
+func (r *txtRecord) setBytes(key string, value []byte) error {
+	content := make([]byte, 0, len(key)+1+len(value))
+	content = append(content, key...)
+	content = append(content, '=')
+	content = append(content, value...)
+	return r.setRaw(key, content)
+}
+
+// delete removes the entry for key, if present, shifting later entries
+// down and fixing up their recorded offsets. key is matched
+// case-insensitively, as setRaw stores it. It returns
+// errTXTKeyNotPresent if key has no entry.
+func (r *txtRecord) delete(key string) error {
+	key = strings.ToLower(key)
+	offset, ok := r.offsets[key]
+	if !ok {
+		return errTXTKeyNotPresent
+	}
+	entryLen := int(r.b[offset])
+	r.b = append(r.b[:offset], r.b[offset+1+entryLen:]...)
+	delete(r.offsets, key)
+	r.l -= 1 + entryLen
+	for k, o := range r.offsets {
+		if o > offset {
+			r.offsets[k] = o - (1 + entryLen)
+		}
+	}
+	return nil
+}
+
+// TXTValueState distinguishes the four ways RFC 6763 §6 treats a TXT
+// record key, a distinction a plain map[string]string collapses: the
+// key can be absent entirely, present as a bare attribute with no '=',
+// present with an explicitly empty value ("key="), or present with a
+// value, which may be arbitrary binary octets (§6.5).
+type TXTValueState int
+
+const (
+	// TXTAbsent means key has no entry in the record at all.
+	TXTAbsent TXTValueState = iota
+	// TXTFlag means key is present as a bare attribute, with no '='.
+	TXTFlag
+	// TXTEmpty means key is present with an explicitly empty value.
+	TXTEmpty
+	// TXTPresent means key is present with a (possibly binary) value.
+	TXTPresent
+)
+
+// TXTRecord is a TXT record parsed by decodeTxt that keeps the RFC 6763
+// §6 distinctions above. Keys are matched case-insensitively per §6.4.
+type TXTRecord struct {
+	entries map[string]txtDecoded
+}
+
+type txtDecoded struct {
+	rawKey string
+	state  TXTValueState
+	value  []byte
+}
+
+// Get reports key's state and, if TXTPresent, its raw value.
+func (r TXTRecord) Get(key string) (value []byte, state TXTValueState) {
+	e, ok := r.entries[strings.ToLower(key)]
+	if !ok {
+		return nil, TXTAbsent
+	}
+	return e.value, e.state
+}
+
+// Map collapses the record to the pre-existing map[string]string shape:
+// a bare flag and an explicitly empty value both read back as "". Keys
+// keep the casing they were published with, not the folded casing used
+// internally for case-insensitive lookup.
+func (r TXTRecord) Map() map[string]string {
+	m := make(map[string]string, len(r.entries))
+	for _, e := range r.entries {
+		m[e.rawKey] = string(e.value)
+	}
+	return m
+}
+
+// decodeTxt parses a wire-format TXT record, as delivered to a
+// ResolveOp callback, into a TXTRecord. A malformed entry whose length
+// byte would run past the end of b ends parsing early.
+func decodeTxt(b []byte) TXTRecord {
+	rec := TXTRecord{entries: make(map[string]txtDecoded)}
+	for i := 0; i < len(b); {
+		l := int(b[i])
+		i++
+		if i+l > len(b) {
+			break
+		}
+		entry := b[i : i+l]
+		i += l
+		var key string
+		var d txtDecoded
+		if idx := indexByte(entry, '='); idx >= 0 {
+			key = string(entry[:idx])
+			value := entry[idx+1:]
+			if len(value) == 0 {
+				d.state = TXTEmpty
+			} else {
+				d.state = TXTPresent
+				d.value = append([]byte(nil), value...)
+			}
+		} else {
+			key = string(entry)
+			d.state = TXTFlag
+		}
+		d.rawKey = key
+		rec.entries[strings.ToLower(key)] = d
+	}
+	return rec
+}
+
+// indexByte returns the index of the first occurrence of c in b, or -1
+// if c is not present.
+func indexByte(b []byte, c byte) int {
+	for i, v := range b {
+		if v == c {
+			return i
+		}
+	}
+	return -1
+}